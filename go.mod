@@ -1,3 +1,8 @@
 module github.com/oberwager/cloudflare-ddns
 
 go 1.25
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	gopkg.in/yaml.v3 v3.0.1
+)
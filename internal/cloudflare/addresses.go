@@ -0,0 +1,47 @@
+package cloudflare
+
+import (
+	"fmt"
+	"maps"
+	"net"
+
+	"github.com/oberwager/cloudflare-ddns/internal/config"
+)
+
+type Addresses struct {
+	IPv4 string
+	IPv6 string
+}
+
+type DetectedIPs struct {
+	IPv4    string
+	IPv6    string
+	Sources map[string]Addresses
+}
+
+func (d DetectedIPs) Equal(other DetectedIPs) bool {
+	return d.IPv4 == other.IPv4 && d.IPv6 == other.IPv6 && maps.Equal(d.Sources, other.Sources)
+}
+
+func (d DetectedIPs) forSubdomain(sub config.Subdomain) (Addresses, error) {
+	if sub.Content != "" && isAddressType(sub.Type) {
+		parsed := net.ParseIP(sub.Content)
+		if parsed == nil {
+			return Addresses{}, fmt.Errorf("invalid content %q", sub.Content)
+		}
+		if parsed.To4() != nil {
+			return Addresses{IPv4: sub.Content}, nil
+		}
+		return Addresses{IPv6: sub.Content}, nil
+	}
+
+	if sub.IPSource != "" {
+		addrs := d.Sources[sub.IPSource]
+		if addrs.IPv4 == "" && addrs.IPv6 == "" {
+			return Addresses{}, fmt.Errorf("ip source %q has no detected address", sub.IPSource)
+		}
+		return addrs, nil
+	}
+
+	return Addresses{IPv4: d.IPv4, IPv6: d.IPv6}, nil
+}
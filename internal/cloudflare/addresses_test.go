@@ -0,0 +1,61 @@
+package cloudflare
+
+import (
+	"testing"
+
+	"github.com/oberwager/cloudflare-ddns/internal/config"
+)
+
+func TestDetectedIPsForSubdomain(t *testing.T) {
+	ips := DetectedIPs{
+		IPv4: "198.51.100.1",
+		IPv6: "2001:db8::1",
+		Sources: map[string]Addresses{
+			"vpn":     {IPv4: "203.0.113.5"},
+			"offline": {},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		sub     config.Subdomain
+		want    Addresses
+		wantErr bool
+	}{
+		{"default", config.Subdomain{Name: "www"}, Addresses{IPv4: "198.51.100.1", IPv6: "2001:db8::1"}, false},
+		{"static ipv4", config.Subdomain{Name: "nas", Content: "192.0.2.10"}, Addresses{IPv4: "192.0.2.10"}, false},
+		{"static ipv6", config.Subdomain{Name: "nas", Content: "2001:db8::10"}, Addresses{IPv6: "2001:db8::10"}, false},
+		{"ip source", config.Subdomain{Name: "vpn", IPSource: "vpn"}, Addresses{IPv4: "203.0.113.5"}, false},
+		{"ip source without address", config.Subdomain{Name: "x", IPSource: "offline"}, Addresses{}, true},
+		{"unknown ip source", config.Subdomain{Name: "x", IPSource: "missing"}, Addresses{}, true},
+		{"invalid content", config.Subdomain{Name: "x", Content: "nope"}, Addresses{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ips.forSubdomain(tt.sub)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("forSubdomain() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("forSubdomain() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectedIPsEqual(t *testing.T) {
+	a := DetectedIPs{IPv4: "198.51.100.1", Sources: map[string]Addresses{"vpn": {IPv4: "203.0.113.5"}}}
+	b := DetectedIPs{IPv4: "198.51.100.1", Sources: map[string]Addresses{"vpn": {IPv4: "203.0.113.5"}}}
+	c := DetectedIPs{IPv4: "198.51.100.1", Sources: map[string]Addresses{"vpn": {IPv4: "203.0.113.6"}}}
+
+	if !a.Equal(b) {
+		t.Error("expected identical detections to be equal")
+	}
+	if a.Equal(c) {
+		t.Error("expected a changed source address to be unequal")
+	}
+	if a.Equal(DetectedIPs{IPv4: "198.51.100.1"}) {
+		t.Error("expected missing sources to be unequal")
+	}
+}
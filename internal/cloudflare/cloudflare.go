@@ -8,60 +8,147 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/oberwager/cloudflare-ddns/internal/config"
+	"github.com/oberwager/cloudflare-ddns/internal/metrics"
 	"github.com/oberwager/cloudflare-ddns/internal/retry"
+	"github.com/oberwager/cloudflare-ddns/internal/tracing"
 )
 
+var retryConfig = func() retry.Config {
+	config := retry.DefaultConfig()
+	config.OnRetry = func() { metrics.RetryAttempts.Inc() }
+	return config
+}()
+
 type Record struct {
-	ID      string `json:"id,omitempty"`
-	Type    string `json:"type"`
-	Name    string `json:"name"`
-	Content string `json:"content"`
-	Proxied bool   `json:"proxied"`
-	TTL     int    `json:"ttl"`
+	ID       string      `json:"id,omitempty"`
+	Type     string      `json:"type"`
+	Name     string      `json:"name"`
+	Content  string      `json:"content,omitempty"`
+	Data     *RecordData `json:"data,omitempty"`
+	Priority *int        `json:"priority,omitempty"`
+	Proxied  bool        `json:"proxied"`
+	TTL      int         `json:"ttl"`
+	Comment  string      `json:"comment,omitempty"`
+	Tags     []string    `json:"tags,omitempty"`
+}
+
+type ResponseInfo struct {
+	Code       int            `json:"code"`
+	Message    string         `json:"message"`
+	ErrorChain []ResponseInfo `json:"error_chain,omitempty"`
 }
 
 type ZoneResponse struct {
 	Result struct {
 		Name string `json:"name"`
 	} `json:"result"`
-	Success bool     `json:"success"`
-	Errors  []string `json:"errors"`
+	Success bool           `json:"success"`
+	Errors  []ResponseInfo `json:"errors"`
 }
 
 type ListRecordsResponse struct {
-	Result  []Record `json:"result"`
-	Success bool     `json:"success"`
-	Errors  []string `json:"errors"`
+	Result     []Record `json:"result"`
+	ResultInfo struct {
+		Page       int `json:"page"`
+		TotalPages int `json:"total_pages"`
+	} `json:"result_info"`
+	Success bool           `json:"success"`
+	Errors  []ResponseInfo `json:"errors"`
+}
+
+// RecordResponse is the envelope around a single record, as returned when a
+// record is fetched, created, updated or deleted.
+type RecordResponse struct {
+	Result  Record         `json:"result"`
+	Success bool           `json:"success"`
+	Errors  []ResponseInfo `json:"errors"`
+}
+
+const ManagedComment = "managed by cloudflare-ddns"
+
+type Options struct {
+	DefaultTTL       int
+	ConcurrencyLimit int
+	DryRun           bool
+	DefaultComment   string
+	Owner            string
+	Prune            bool
+	Duplicates       string
 }
 
-func ProcessZone(ctx context.Context, token string, zone config.Zone, ipv4, ipv6 string, defaultTTL, concurrencyLimit int) error {
+// Duplicate policies for names holding several records of the managed type.
+// Without one, the first record is updated and the rest are left alone.
+const (
+	DeleteDuplicates = "delete_extra"
+	UpdateDuplicates = "update_all"
+	FailOnDuplicates = "fail"
+)
+
+func ProcessZone(ctx context.Context, token string, zone config.Zone, ips DetectedIPs, opts Options) (summary ZoneSummary, err error) {
+	ctx, span := tracing.Start(ctx, "ProcessZone", tracing.String("zone_id", zone.ZoneID))
+	defer func() {
+		span.SetAttributes(tracing.String("domain", summary.Domain), tracing.Int("records", len(summary.Records)),
+			tracing.Int("failed", summary.Count(Failed)))
+		span.End(err)
+	}()
+
+	summary = ZoneSummary{ZoneID: zone.ZoneID}
+
 	zoneData, err := cfAPI(ctx, "GET", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s", zone.ZoneID), token, nil)
 	if err != nil {
-		return fmt.Errorf("get zone: %w", err)
+		return summary, fmt.Errorf("get zone: %w", err)
 	}
 
 	var zoneResp ZoneResponse
 	if err := json.Unmarshal(zoneData, &zoneResp); err != nil {
-		return fmt.Errorf("unmarshal zone response: %w", err)
+		return summary, fmt.Errorf("unmarshal zone response: %w", err)
 	}
 	if !zoneResp.Success {
-		return fmt.Errorf("zone API error: %v", zoneResp.Errors)
+		return summary, fmt.Errorf("get zone: %w", newAPIError(http.StatusOK, zoneResp.Errors))
 	}
 
 	baseDomain := zoneResp.Result.Name
-	slog.Debug("processing zone", "zone_id", zone.ZoneID, "domain", baseDomain)
+	summary.Domain = baseDomain
+	slog.DebugContext(ctx, "processing zone", "zone_id", zone.ZoneID, "domain", baseDomain)
 
 	zoneTTL := zone.TTL
 	if zoneTTL == 0 {
-		zoneTTL = defaultTTL
+		zoneTTL = opts.DefaultTTL
+	}
+
+	// Rendered once so every record in the run carries the same timestamp.
+	hostname, _ := os.Hostname()
+	content := config.ContentData{Hostname: hostname, Timestamp: time.Now().UTC().Format(time.RFC3339)}
+
+	var registry map[string]registryEntry
+	var registryErr error
+	if opts.Owner != "" {
+		registry, registryErr = readRegistry(ctx, token, zone.ZoneID)
 	}
+	owned := ownedIDs(registry, opts.Owner)
 
-	sem := make(chan struct{}, concurrencyLimit)
+	sem := make(chan struct{}, opts.ConcurrencyLimit)
 	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	record := func(result RecordResult) {
+		if result.Err != nil {
+			slog.ErrorContext(ctx, "failed to upsert "+result.Type+" record", "fqdn", result.FQDN, "error", result.Err, ErrorDetails(result.Err))
+			result.Outcome = Failed
+		}
+		mu.Lock()
+		summary.Records = append(summary.Records, result)
+		mu.Unlock()
+	}
 
 	for _, sub := range zone.Subdomains {
 		wg.Add(1)
@@ -71,117 +158,387 @@ func ProcessZone(ctx context.Context, token string, zone config.Zone, ipv4, ipv6
 			sem <- struct{}{}
 			defer func() { <-sem }()
 
-			name := strings.ToLower(strings.TrimSpace(s.Name))
-			fqdn := baseDomain
-			if name != "" && name != "@" {
-				fqdn = name + "." + baseDomain
-			}
+			fqdn := subdomainFQDN(s.Name, baseDomain)
 
 			ttl := s.TTL
 			if ttl == 0 {
 				ttl = zoneTTL
 			}
 
-			if err := upsertRecord(ctx, token, zone.ZoneID, fqdn, "A", ipv4, s.Proxied, ttl); err != nil {
-				slog.Error("failed to upsert A record", "fqdn", fqdn, "error", err)
+			addrs, err := ips.forSubdomain(s)
+			if err != nil {
+				record(RecordResult{FQDN: fqdn, Type: recordType(s), Err: err})
+				return
+			}
+
+			desired, err := desiredRecords(s, fqdn, addrs, ttl, content)
+			if err != nil {
+				record(RecordResult{FQDN: fqdn, Type: recordType(s), Err: err})
+				return
 			}
 
-			if ipv6 != "" {
-				if err := upsertRecord(ctx, token, zone.ZoneID, fqdn, "AAAA", ipv6, s.Proxied, ttl); err != nil {
-					slog.Error("failed to upsert AAAA record", "fqdn", fqdn, "error", err)
+			comment := s.Comment
+			if comment == "" {
+				comment = opts.DefaultComment
+			}
+
+			match := recordMatcher{owned: owned}
+			if recordType(s) == "TXT" {
+				// Recognise what this record held before the address changed.
+				match.pattern = contentPattern(s.Content, contentPlaceholders)
+			}
+			if t := recordType(s); (t == "TXT" || t == "SPF") && s.Content != "" {
+				data := content
+				data.IPv4, data.IPv6, data.Timestamp = addrs.IPv4, addrs.IPv6, contentPlaceholders.Timestamp
+				match.current = contentPattern(s.Content, data)
+			}
+
+			for _, rec := range desired {
+				rec.Comment, rec.Tags = comment, s.Tags
+				for _, result := range upsertRecord(ctx, token, zone.ZoneID, rec, match, opts) {
+					record(result)
 				}
 			}
 		}(sub)
 	}
 
 	wg.Wait()
-	return nil
+
+	switch {
+	case registryErr != nil:
+		slog.ErrorContext(ctx, "failed to read ownership registry", "zone_id", zone.ZoneID, "error", registryErr, ErrorDetails(registryErr))
+		summary.Records = append(summary.Records, RecordResult{FQDN: baseDomain, Type: "TXT", Outcome: Failed, Err: registryErr})
+	case opts.Owner != "":
+		summary.Records = append(summary.Records, syncOwnership(ctx, token, zone, baseDomain, summary.Records, registry, opts)...)
+	}
+
+	summary.sortRecords()
+	return summary, nil
+}
+
+func subdomainFQDN(name, baseDomain string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || name == "@" {
+		return baseDomain
+	}
+	return name + "." + baseDomain
 }
 
-func upsertRecord(ctx context.Context, token, zoneID, fqdn, recordType, ip string, proxied bool, ttl int) error {
+func upsertRecord(ctx context.Context, token, zoneID string, record Record, match recordMatcher, opts Options) (results []RecordResult) {
+	ctx, span := tracing.Start(ctx, "upsertRecord", tracing.String("fqdn", record.Name), tracing.String("type", record.Type))
+	defer func() {
+		span.SetAttributes(tracing.String("outcome", string(results[0].Outcome)), tracing.Int("results", len(results)))
+		span.End(results[0].Err)
+	}()
+
+	fqdn, recordType, proxied, ttl := record.Name, record.Type, record.Proxied, record.TTL
+	result := RecordResult{FQDN: fqdn, Type: recordType, New: &record}
+	value := valueAttr("ip", record)
+	fail := func(err error) []RecordResult {
+		result.Err = err
+		return []RecordResult{result}
+	}
+
 	listURL := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records?type=%s&name=%s", zoneID, recordType, fqdn)
 	listData, err := cfAPI(ctx, "GET", listURL, token, nil)
 	if err != nil {
-		return fmt.Errorf("list records: %w", err)
+		return fail(fmt.Errorf("list records: %w", err))
 	}
 
 	var listResp ListRecordsResponse
 	if err := json.Unmarshal(listData, &listResp); err != nil {
-		return fmt.Errorf("unmarshal list response: %w", err)
+		return fail(fmt.Errorf("unmarshal list response: %w", err))
 	}
 	if !listResp.Success {
-		return fmt.Errorf("list API error: %v", listResp.Errors)
+		return fail(fmt.Errorf("list records: %w", newAPIError(http.StatusOK, listResp.Errors)))
 	}
 
-	record := Record{
-		Type:    recordType,
-		Name:    fqdn,
-		Content: ip,
-		Proxied: proxied,
-		TTL:     ttl,
-	}
+	listResp.Result = slices.DeleteFunc(listResp.Result, func(r Record) bool { return !match.claims(r, record) })
 
 	if len(listResp.Result) == 0 {
+		result.Outcome = Created
+		if opts.DryRun {
+			slog.InfoContext(ctx, "would create record", "fqdn", fqdn, "type", recordType, value, "proxied", proxied, "ttl", ttl)
+			return []RecordResult{result}
+		}
+
 		createURL := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records", zoneID)
-		if _, err := cfAPI(ctx, "POST", createURL, token, record); err != nil {
-			return fmt.Errorf("create record: %w", err)
+		created, err := cfWrite(ctx, "POST", createURL, token, record)
+		if err != nil {
+			return fail(fmt.Errorf("create record: %w", err))
+		}
+		record.ID = created.ID
+		slog.InfoContext(ctx, "created record", "fqdn", fqdn, "type", recordType, value, "proxied", proxied, "ttl", ttl)
+		return []RecordResult{result}
+	}
+
+	existing := listResp.Result
+	if len(existing) > 1 {
+		// Prefer a record that already holds the desired value, then the lowest
+		// ID, so the kept record doesn't depend on API ordering.
+		slices.SortStableFunc(existing, func(a, b Record) int {
+			if am, bm := match.sameValue(a, record), match.sameValue(b, record); am != bm {
+				if am {
+					return -1
+				}
+				return 1
+			}
+			return strings.Compare(a.ID, b.ID)
+		})
+
+		switch opts.Duplicates {
+		case FailOnDuplicates:
+			return fail(fmt.Errorf("%d %s records found for %s and duplicate_policy is %s", len(existing), recordType, fqdn, FailOnDuplicates))
+		case UpdateDuplicates:
+			slog.WarnContext(ctx, "multiple records found, updating all of them", "fqdn", fqdn, "type", recordType, "count", len(existing))
+		case DeleteDuplicates:
+			slog.WarnContext(ctx, "multiple records found, updating the first one and deleting the rest", "fqdn", fqdn, "type", recordType, "count", len(existing))
+		default:
+			slog.WarnContext(ctx, "multiple records found, updating the first one", "fqdn", fqdn, "type", recordType, "count", len(existing))
 		}
-		slog.Info("created record", "fqdn", fqdn, "type", recordType, "ip", ip, "proxied", proxied, "ttl", ttl)
-		return nil
 	}
 
-	if len(listResp.Result) > 1 {
-		slog.Warn("multiple records found, updating the first one", "fqdn", fqdn, "type", recordType, "count", len(listResp.Result))
+	results = []RecordResult{updateRecord(ctx, token, zoneID, record, existing[0], match, opts.DryRun)}
+	for _, dup := range existing[1:] {
+		switch {
+		case opts.Duplicates == UpdateDuplicates:
+			results = append(results, updateRecord(ctx, token, zoneID, record, dup, match, opts.DryRun))
+		case opts.Duplicates != DeleteDuplicates:
+			// Without an explicit policy the rest are left untouched.
+		case opts.Owner != "" && !match.owned[dup.ID]:
+			// With ownership enabled, only records this instance registered are deleted.
+			slog.WarnContext(ctx, "leaving duplicate record not owned by this instance", "fqdn", fqdn, "type", recordType, "id", dup.ID, valueAttr("ip", dup))
+		default:
+			results = append(results, deleteDuplicate(ctx, token, zoneID, fqdn, dup, opts.DryRun))
+		}
+	}
+	return results
+}
+
+func updateRecord(ctx context.Context, token, zoneID string, record, existing Record, match recordMatcher, dryRun bool) RecordResult {
+	// A PUT replaces the whole record, so keep a comment or tags the config
+	// doesn't set rather than wiping what someone added by hand.
+	if record.Comment == "" {
+		record.Comment = existing.Comment
 	}
+	if len(record.Tags) == 0 {
+		record.Tags = existing.Tags
+	}
+
+	fqdn, recordType, proxied, ttl := record.Name, record.Type, record.Proxied, record.TTL
+	result := RecordResult{FQDN: fqdn, Type: recordType, Old: &existing, New: &record}
+	value := valueAttr("ip", record)
 
-	existing := listResp.Result[0]
 	ttlMatches := existing.TTL == ttl || (proxied && existing.TTL == 1)
-	if existing.Content == ip && existing.Proxied == proxied && ttlMatches {
-		slog.Debug("record already up to date", "fqdn", fqdn, "type", recordType, "ip", ip)
-		return nil
+	if match.sameValue(existing, record) && existing.Proxied == proxied && ttlMatches && sameMetadata(existing, record) {
+		slog.DebugContext(ctx, "record already up to date", "fqdn", fqdn, "type", recordType, value)
+		result.Outcome = Unchanged
+		record.ID = existing.ID
+		return result
+	}
+
+	result.Outcome = Updated
+	if dryRun {
+		slog.InfoContext(ctx, "would update record", "fqdn", fqdn, "type", recordType, value, "proxied", proxied, "ttl", ttl,
+			valueAttr("old_ip", existing), "old_proxied", existing.Proxied, "old_ttl", existing.TTL)
+		return result
 	}
 
 	updateURL := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records/%s", zoneID, existing.ID)
-	if _, err := cfAPI(ctx, "PUT", updateURL, token, record); err != nil {
-		return fmt.Errorf("update record: %w", err)
+	if _, err := cfWrite(ctx, "PUT", updateURL, token, record); err != nil {
+		result.Err = fmt.Errorf("update record: %w", err)
+		return result
+	}
+	record.ID = existing.ID
+	slog.InfoContext(ctx, "updated record", "fqdn", fqdn, "type", recordType, value, "proxied", proxied, "ttl", ttl,
+		valueAttr("old_ip", existing), "old_proxied", existing.Proxied, "old_ttl", existing.TTL)
+	return result
+}
+
+func deleteDuplicate(ctx context.Context, token, zoneID, fqdn string, existing Record, dryRun bool) RecordResult {
+	result := RecordResult{FQDN: fqdn, Type: existing.Type, Outcome: Deleted, Old: &existing}
+	if dryRun {
+		slog.InfoContext(ctx, "would delete duplicate record", "fqdn", fqdn, "type", existing.Type, valueAttr("ip", existing))
+		return result
 	}
-	slog.Info("updated record", "fqdn", fqdn, "type", recordType, "ip", ip, "proxied", proxied, "ttl", ttl,
-		"old_ip", existing.Content, "old_proxied", existing.Proxied, "old_ttl", existing.TTL)
-	return nil
+
+	deleteURL := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records/%s", zoneID, existing.ID)
+	if _, err := cfWrite(ctx, "DELETE", deleteURL, token, nil); err != nil {
+		result.Err = fmt.Errorf("delete duplicate record: %w", err)
+		return result
+	}
+	slog.InfoContext(ctx, "deleted duplicate record", "fqdn", fqdn, "type", existing.Type, valueAttr("ip", existing))
+	return result
+}
+
+// valueAttr logs address records under key (ip/old_ip) and everything else
+// under the matching content key.
+func valueAttr(key string, r Record) slog.Attr {
+	if r.Type != "A" && r.Type != "AAAA" {
+		key = strings.Replace(key, "ip", "content", 1)
+	}
+	return slog.String(key, recordValue(r))
+}
+
+func sameMetadata(a, b Record) bool {
+	return a.Comment == b.Comment && sameTags(a.Tags, b.Tags)
+}
+
+func sameTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	// Tag order carries no meaning and Cloudflare may return them sorted.
+	tagsA, tagsB := slices.Clone(a), slices.Clone(b)
+	slices.Sort(tagsA)
+	slices.Sort(tagsB)
+	return slices.Equal(tagsA, tagsB)
+}
+
+func isSPF(r Record) bool {
+	return strings.HasPrefix(recordValue(r), "v=spf1")
 }
 
 func cfAPI(ctx context.Context, method, url, token string, body any) ([]byte, error) {
-	var reqBody io.Reader
+	var data []byte
 	if body != nil {
-		data, err := json.Marshal(body)
-		if err != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
 			return nil, fmt.Errorf("marshal request body: %w", err)
 		}
+	}
+
+	var respBody []byte
+	attempt := 0
+	err := retry.WithBackoff(ctx, method+" "+url, retryConfig, func() error {
+		ctx, span := tracing.StartClient(ctx, "cfAPI "+method, tracing.String("http.method", method),
+			tracing.String("url.path", requestPath(url)), tracing.Int("retry.attempt", attempt))
+		attempt++
+
+		var err error
+		respBody, err = doRequest(ctx, method, url, token, data)
+		span.End(err)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return respBody, nil
+}
+
+// cfWrite creates, updates or deletes a record. Cloudflare can reject a write
+// with HTTP 200 and success:false, so unlike cfAPI it checks the response body.
+func cfWrite(ctx context.Context, method, url, token string, body any) (Record, error) {
+	data, err := cfAPI(ctx, method, url, token, body)
+	if err != nil {
+		return Record{}, err
+	}
+
+	var resp RecordResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return Record{}, fmt.Errorf("unmarshal record response: %w", err)
+	}
+	if !resp.Success {
+		return Record{}, newAPIError(http.StatusOK, resp.Errors)
+	}
+	return resp.Result, nil
+}
+
+func requestPath(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Path
+	}
+	return rawURL
+}
+
+func doRequest(ctx context.Context, method, url, token string, data []byte) ([]byte, error) {
+	var reqBody io.Reader
+	if data != nil {
 		reqBody = bytes.NewReader(data)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+		return nil, retry.Permanent(fmt.Errorf("create request: %w", err))
 	}
 
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Content-Type", "application/json")
 
+	// A create that failed with a 5xx, a timeout or a dropped connection may
+	// still have been committed, and retrying it would add a duplicate record,
+	// so only retry it when rate limited.
+	create := method == http.MethodPost
+	failed := func(err error) error {
+		if create {
+			return retry.Permanent(err)
+		}
+		return err
+	}
+
+	start := time.Now()
 	resp, err := retry.HTTPClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("execute request: %w", err)
+		metrics.APIRequestDuration.Observe(time.Since(start).Seconds(), method, "error")
+		return nil, failed(fmt.Errorf("execute request: %w", err))
 	}
 	defer resp.Body.Close()
+	metrics.APIRequestDuration.Observe(time.Since(start).Seconds(), method, strconv.Itoa(resp.StatusCode))
+	tracing.FromContext(ctx).SetAttributes(tracing.Int("http.status_code", resp.StatusCode))
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
+		return nil, failed(fmt.Errorf("read response: %w", err))
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || (resp.StatusCode >= 500 && !create) {
+		return nil, retry.Retryable(decodeAPIError(resp.StatusCode, respBody), rateLimitDelay(resp.Header, time.Now()))
 	}
 
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, respBody)
+		return nil, retry.Permanent(decodeAPIError(resp.StatusCode, respBody))
 	}
 
 	return respBody, nil
 }
+
+func rateLimitDelay(h http.Header, now time.Time) time.Duration {
+	if val := strings.TrimSpace(h.Get("Retry-After")); val != "" {
+		if secs, err := strconv.Atoi(val); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second
+		}
+		if at, err := http.ParseTime(val); err == nil {
+			if d := at.Sub(now); d > 0 {
+				return d
+			}
+			return 0
+		}
+	}
+
+	// Cloudflare's API sends the IETF draft header, e.g. `"default";r=0;t=30`.
+	if val := h.Get("Ratelimit"); val != "" {
+		for _, param := range strings.Split(val, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || key != "t" {
+				continue
+			}
+			if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+				return time.Duration(secs) * time.Second
+			}
+		}
+	}
+
+	if val := h.Get("X-RateLimit-Reset"); val != "" {
+		if secs, err := strconv.ParseInt(val, 10, 64); err == nil && secs >= 0 {
+			// Some proxies send an epoch timestamp rather than a delta.
+			if secs > now.Unix() {
+				return time.Unix(secs, 0).Sub(now)
+			}
+			return time.Duration(secs) * time.Second
+		}
+	}
+
+	return 0
+}
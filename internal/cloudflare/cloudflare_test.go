@@ -3,11 +3,16 @@ package cloudflare
 import (
 	"context"
 	"encoding/json"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"path"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/oberwager/cloudflare-ddns/internal/config"
 	"github.com/oberwager/cloudflare-ddns/internal/retry"
@@ -24,7 +29,20 @@ func (m *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	return m.server.Client().Transport.RoundTrip(req)
 }
 
+func useFastRetries(t *testing.T) {
+	t.Helper()
+	original := retryConfig
+	retryConfig = retry.Config{
+		MaxRetries:  2,
+		InitialWait: 1 * time.Millisecond,
+		MaxWait:     5 * time.Millisecond,
+	}
+	t.Cleanup(func() { retryConfig = original })
+}
+
 func TestCfAPI(t *testing.T) {
+	useFastRetries(t)
+
 	tests := []struct {
 		name       string
 		method     string
@@ -94,6 +112,138 @@ func TestCfAPI(t *testing.T) {
 	}
 }
 
+func TestCfAPIRetries(t *testing.T) {
+	useFastRetries(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		statusCode int
+		wantCalls  int
+		wantErr    bool
+	}{
+		{"rate limited then success", "GET", http.StatusTooManyRequests, 2, false},
+		{"server error then success", "GET", http.StatusBadGateway, 2, false},
+		{"auth error is permanent", "GET", http.StatusForbidden, 1, true},
+		{"validation error is permanent", "GET", http.StatusBadRequest, 1, true},
+		{"rate limited create is retried", "POST", http.StatusTooManyRequests, 2, false},
+		{"failed create is not retried", "POST", http.StatusBadGateway, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callCount := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				callCount++
+				if callCount == 1 {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(tt.statusCode)
+					w.Write([]byte(`{"success": false}`))
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"success": true}`))
+			}))
+			defer server.Close()
+
+			_, err := cfAPI(context.Background(), tt.method, server.URL, "test-token", nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("cfAPI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if callCount != tt.wantCalls {
+				t.Errorf("expected %d calls, got %d", tt.wantCalls, callCount)
+			}
+		})
+	}
+}
+
+func TestCfAPICreateNotRetriedAfterHangUp(t *testing.T) {
+	useFastRetries(t)
+
+	tests := []struct {
+		method    string
+		wantCalls int
+	}{
+		{"POST", 1},
+		{"PUT", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			callCount := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				callCount++
+				io.ReadAll(r.Body)
+				// Reset the connection without answering, as if it dropped after
+				// Cloudflare accepted the request.
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.(*net.TCPConn).SetLinger(0)
+				conn.Close()
+			}))
+			defer server.Close()
+
+			_, err := cfAPI(context.Background(), tt.method, server.URL, "test-token", map[string]string{"content": "1.2.3.4"})
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if callCount != tt.wantCalls {
+				t.Errorf("expected %d calls, got %d", tt.wantCalls, callCount)
+			}
+		})
+	}
+}
+
+func TestCfAPIRetriesExhausted(t *testing.T) {
+	useFastRetries(t)
+
+	callCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callCount++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := cfAPI(context.Background(), "PUT", server.URL, "test-token", map[string]string{"content": "1.2.3.4"})
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if callCount != 3 {
+		t.Errorf("expected 3 calls (initial + 2 retries), got %d", callCount)
+	}
+}
+
+func TestRateLimitDelay(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    time.Duration
+	}{
+		{"no headers", nil, 0},
+		{"retry-after seconds", map[string]string{"Retry-After": "7"}, 7 * time.Second},
+		{"retry-after http date", map[string]string{"Retry-After": now.Add(90 * time.Second).Format(http.TimeFormat)}, 90 * time.Second},
+		{"retry-after in the past", map[string]string{"Retry-After": now.Add(-time.Minute).Format(http.TimeFormat)}, 0},
+		{"ratelimit header", map[string]string{"Ratelimit": `"default";r=0;t=30`}, 30 * time.Second},
+		{"x-ratelimit-reset delta", map[string]string{"X-RateLimit-Reset": "12"}, 12 * time.Second},
+		{"x-ratelimit-reset epoch", map[string]string{"X-RateLimit-Reset": "1735689605"}, 5 * time.Second},
+		{"retry-after takes precedence", map[string]string{"Retry-After": "3", "Ratelimit": `"default";r=0;t=30`}, 3 * time.Second},
+		{"garbage", map[string]string{"Retry-After": "soon"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.headers {
+				h.Set(k, v)
+			}
+			if got := rateLimitDelay(h, now); got != tt.want {
+				t.Errorf("rateLimitDelay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestUpsertRecordCreate(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if strings.Contains(r.URL.Path, "/dns_records") && r.Method == "GET" {
@@ -121,11 +271,15 @@ func TestUpsertRecordCreate(t *testing.T) {
 
 	ctx := context.Background()
 	zoneID := "zone123"
-	err := upsertRecord(ctx, "token", zoneID, "test.example.com", "A", "1.2.3.4", true, 300)
+	desired := Record{Type: "A", Name: "test.example.com", Content: "1.2.3.4", Proxied: true, TTL: 300}
+	result, err := upsertOne(ctx, "token", zoneID, desired, Options{})
 
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
+	if result.Outcome != Created {
+		t.Errorf("expected outcome %s, got %s", Created, result.Outcome)
+	}
 }
 
 func TestUpsertRecordUpdate(t *testing.T) {
@@ -169,11 +323,15 @@ func TestUpsertRecordUpdate(t *testing.T) {
 
 	ctx := context.Background()
 	zoneID := "zone123"
-	err := upsertRecord(ctx, "token", zoneID, "test.example.com", "A", "1.2.3.4", true, 300)
+	desired := Record{Type: "A", Name: "test.example.com", Content: "1.2.3.4", Proxied: true, TTL: 300}
+	result, err := upsertOne(ctx, "token", zoneID, desired, Options{})
 
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
+	if result.Outcome != Updated {
+		t.Errorf("expected outcome %s, got %s", Updated, result.Outcome)
+	}
 }
 
 func TestUpsertRecordNoChange(t *testing.T) {
@@ -212,11 +370,15 @@ func TestUpsertRecordNoChange(t *testing.T) {
 
 	ctx := context.Background()
 	zoneID := "zone123"
-	err := upsertRecord(ctx, "token", zoneID, "test.example.com", "A", "1.2.3.4", true, 300)
+	desired := Record{Type: "A", Name: "test.example.com", Content: "1.2.3.4", Proxied: true, TTL: 300}
+	result, err := upsertOne(ctx, "token", zoneID, desired, Options{})
 
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
+	if result.Outcome != Unchanged {
+		t.Errorf("expected outcome %s, got %s", Unchanged, result.Outcome)
+	}
 }
 
 func TestUpsertRecordProxiedTTL(t *testing.T) {
@@ -255,35 +417,195 @@ func TestUpsertRecordProxiedTTL(t *testing.T) {
 
 	ctx := context.Background()
 	zoneID := "zone123"
-	err := upsertRecord(ctx, "token", zoneID, "test.example.com", "A", "1.2.3.4", true, 300)
+	desired := Record{Type: "A", Name: "test.example.com", Content: "1.2.3.4", Proxied: true, TTL: 300}
+	result, err := upsertOne(ctx, "token", zoneID, desired, Options{})
 
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
+	if result.Outcome != Unchanged {
+		t.Errorf("expected outcome %s, got %s", Unchanged, result.Outcome)
+	}
 }
 
-func TestUpsertRecordMultipleFound(t *testing.T) {
+// upsertOne returns the result for the managed record itself.
+func upsertOne(ctx context.Context, token, zoneID string, record Record, opts Options) (RecordResult, error) {
+	results := upsertRecord(ctx, token, zoneID, record, recordMatcher{}, opts)
+	return results[0], results[0].Err
+}
+
+func TestUpsertRecordDuplicates(t *testing.T) {
+	stale := []Record{
+		{ID: "rec2", Type: "A", Name: "test.example.com", Content: "5.6.7.8", Proxied: true, TTL: 300},
+		{ID: "rec1", Type: "A", Name: "test.example.com", Content: "5.6.7.8", Proxied: true, TTL: 300},
+	}
+	current := []Record{
+		{ID: "rec1", Type: "A", Name: "test.example.com", Content: "5.6.7.8", Proxied: true, TTL: 300},
+		{ID: "rec2", Type: "A", Name: "test.example.com", Content: "1.2.3.4", Proxied: true, TTL: 300},
+	}
+
+	tests := []struct {
+		name       string
+		existing   []Record
+		policy     string
+		owner      string
+		owned      map[string]bool
+		wantWrites []string
+		want       []Outcome
+		wantErr    bool
+	}{
+		{
+			name:       "leaves the rest by default",
+			existing:   stale,
+			wantWrites: []string{"PUT rec1"},
+			want:       []Outcome{Updated},
+		},
+		{
+			name:       "delete extra",
+			existing:   stale,
+			policy:     DeleteDuplicates,
+			wantWrites: []string{"PUT rec1", "DELETE rec2"},
+			want:       []Outcome{Updated, Deleted},
+		},
+		{
+			name: "delete extra only deletes owned records",
+			existing: append(slices.Clone(stale),
+				Record{ID: "rec3", Type: "A", Name: "test.example.com", Content: "9.9.9.9", Proxied: true, TTL: 300}),
+			policy:     DeleteDuplicates,
+			owner:      "home",
+			owned:      map[string]bool{"rec3": true},
+			wantWrites: []string{"PUT rec1", "DELETE rec3"},
+			want:       []Outcome{Updated, Deleted},
+		},
+		{
+			name:       "keeps the record that is already current",
+			existing:   current,
+			policy:     DeleteDuplicates,
+			wantWrites: []string{"DELETE rec1"},
+			want:       []Outcome{Unchanged, Deleted},
+		},
+		{
+			name:       "update all",
+			existing:   stale,
+			policy:     UpdateDuplicates,
+			wantWrites: []string{"PUT rec1", "PUT rec2"},
+			want:       []Outcome{Updated, Updated},
+		},
+		{
+			name:     "fail",
+			existing: stale,
+			policy:   FailOnDuplicates,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var writes []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == "GET" {
+					data, _ := json.Marshal(ListRecordsResponse{Success: true, Result: slices.Clone(tt.existing)})
+					w.Write(data)
+					return
+				}
+				writes = append(writes, r.Method+" "+path.Base(r.URL.Path))
+				w.Write([]byte(`{"success": true}`))
+			}))
+			defer server.Close()
+
+			originalClient := retry.HTTPClient
+			retry.HTTPClient = &http.Client{Transport: &mockTransport{server: server}}
+			defer func() { retry.HTTPClient = originalClient }()
+
+			desired := Record{Type: "A", Name: "test.example.com", Content: "1.2.3.4", Proxied: true, TTL: 300}
+			results := upsertRecord(context.Background(), "token", "zone123", desired, recordMatcher{owned: tt.owned}, Options{Duplicates: tt.policy, Owner: tt.owner})
+
+			if tt.wantErr {
+				if len(results) != 1 || results[0].Err == nil {
+					t.Fatalf("expected a single failed result, got %+v", results)
+				}
+				if len(writes) != 0 {
+					t.Errorf("expected no writes, got %v", writes)
+				}
+				return
+			}
+
+			var got []Outcome
+			for _, r := range results {
+				if r.Err != nil {
+					t.Fatalf("unexpected error: %v", r.Err)
+				}
+				got = append(got, r.Outcome)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("outcomes = %v, want %v", got, tt.want)
+			}
+			if !slices.Equal(writes, tt.wantWrites) {
+				t.Errorf("writes = %v, want %v", writes, tt.wantWrites)
+			}
+		})
+	}
+}
+
+func TestUpsertRecordDryRun(t *testing.T) {
+	var writes int
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.Contains(r.URL.Path, "/dns_records") && r.Method == "GET" {
+		if r.Method != "GET" {
+			writes++
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"success": true}`))
+			return
+		}
+
+		resp := ListRecordsResponse{Success: true}
+		if strings.Contains(r.URL.RawQuery, "existing.example.com") {
+			resp.Result = []Record{{ID: "rec123", Type: "A", Name: "existing.example.com", Content: "5.6.7.8", TTL: 300}}
+		}
+		data, _ := json.Marshal(resp)
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	originalClient := retry.HTTPClient
+	retry.HTTPClient = &http.Client{
+		Transport: &mockTransport{server: server},
+		Timeout:   originalClient.Timeout,
+	}
+	defer func() { retry.HTTPClient = originalClient }()
+
+	ctx := context.Background()
+
+	created, err := upsertOne(ctx, "token", "zone123", Record{Type: "A", Name: "new.example.com", Content: "1.2.3.4", TTL: 300}, Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if created.Outcome != Created || created.Old != nil || created.New.Content != "1.2.3.4" {
+		t.Errorf("unexpected create plan: %+v", created)
+	}
+
+	updated, err := upsertOne(ctx, "token", "zone123", Record{Type: "A", Name: "existing.example.com", Content: "1.2.3.4", TTL: 300}, Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if updated.Outcome != Updated || updated.Old == nil || updated.Old.Content != "5.6.7.8" {
+		t.Errorf("unexpected update plan: %+v", updated)
+	}
+
+	if writes != 0 {
+		t.Errorf("expected no write requests in dry-run, got %d", writes)
+	}
+}
+
+func TestUpsertRecordSPFLeavesOtherTXT(t *testing.T) {
+	var updated string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
 			resp := ListRecordsResponse{
 				Success: true,
 				Result: []Record{
-					{
-						ID:      "rec1",
-						Type:    "A",
-						Name:    "test.example.com",
-						Content: "5.6.7.8",
-						Proxied: true,
-						TTL:     300,
-					},
-					{
-						ID:      "rec2",
-						Type:    "A",
-						Name:    "test.example.com",
-						Content: "5.6.7.8",
-						Proxied: true,
-						TTL:     300,
-					},
+					{ID: "verify", Type: "TXT", Name: "example.com", Content: `"google-site-verification=abc"`, TTL: 300},
+					{ID: "spf", Type: "TXT", Name: "example.com", Content: `"v=spf1 ip4:5.6.7.8 -all"`, TTL: 300},
 				},
 			}
 			data, _ := json.Marshal(resp)
@@ -292,30 +614,38 @@ func TestUpsertRecordMultipleFound(t *testing.T) {
 			return
 		}
 
-		if strings.Contains(r.URL.Path, "/dns_records/rec1") && r.Method == "PUT" {
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte(`{"success": true}`))
-			return
+		if r.Method == "PUT" {
+			updated = r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
 		}
-
-		w.WriteHeader(http.StatusNotFound)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"success": true}`))
 	}))
 	defer server.Close()
 
 	originalClient := retry.HTTPClient
-	retry.HTTPClient = &http.Client{
-		Transport: &mockTransport{server: server},
-		Timeout:   originalClient.Timeout,
-	}
+	retry.HTTPClient = &http.Client{Transport: &mockTransport{server: server}}
 	defer func() { retry.HTTPClient = originalClient }()
 
-	ctx := context.Background()
-	zoneID := "zone123"
-	err := upsertRecord(ctx, "token", zoneID, "test.example.com", "A", "1.2.3.4", true, 300)
+	desired := Record{Type: "TXT", Name: "example.com", Content: "v=spf1 ip4:1.2.3.4 -all", TTL: 300}
+	result, err := upsertOne(context.Background(), "token", "zone123", desired, Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.Outcome != Updated {
+		t.Errorf("expected outcome %s, got %s", Updated, result.Outcome)
+	}
+	if updated != "spf" {
+		t.Errorf("expected the SPF record to be updated, got %q", updated)
+	}
 
+	desired.Content = "v=spf1 ip4:5.6.7.8 -all"
+	result, err = upsertOne(context.Background(), "token", "zone123", desired, Options{})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
+	if result.Outcome != Unchanged {
+		t.Errorf("expected quoted TXT content to compare equal, got %s", result.Outcome)
+	}
 }
 
 func TestProcessZone(t *testing.T) {
@@ -366,12 +696,292 @@ func TestProcessZone(t *testing.T) {
 		},
 	}
 
-	err := ProcessZone(ctx, "token", zone, "1.2.3.4", "", 300, 10)
+	summary, err := ProcessZone(ctx, "token", zone, DetectedIPs{IPv4: "1.2.3.4"}, Options{DefaultTTL: 300, ConcurrencyLimit: 10})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
+	if summary.Domain != "example.com" {
+		t.Errorf("expected domain example.com, got %s", summary.Domain)
+	}
+	if got := summary.Count(Created); got != 2 {
+		t.Errorf("expected 2 created records, got %d", got)
+	}
+
 	if callCount < 3 {
 		t.Errorf("expected at least 3 API calls (1 zone + 2 subdomains), got %d", callCount)
 	}
 }
+
+func TestProcessZoneRecordFailures(t *testing.T) {
+	useFastRetries(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/zones/zone123") && r.Method == "GET" {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"success": true, "result": {"name": "example.com"}}`))
+			return
+		}
+
+		if strings.Contains(r.URL.Path, "/dns_records") && r.Method == "GET" {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"success": true, "result": []}`))
+			return
+		}
+
+		if strings.Contains(r.URL.Path, "/dns_records") && r.Method == "POST" {
+			var rec Record
+			json.NewDecoder(r.Body).Decode(&rec)
+			if rec.Name == "bad.example.com" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"success": false, "errors": [{"code": 81058, "message": "Record quota exceeded."}]}`))
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			if rec.Name == "rejected.example.com" {
+				// Cloudflare can reject a write without an error status.
+				w.Write([]byte(`{"success": false, "errors": [{"code": 1004, "message": "DNS Validation Error"}]}`))
+				return
+			}
+			w.Write([]byte(`{"success": true}`))
+			return
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	originalClient := retry.HTTPClient
+	retry.HTTPClient = &http.Client{
+		Transport: &mockTransport{server: server},
+		Timeout:   originalClient.Timeout,
+	}
+	defer func() { retry.HTTPClient = originalClient }()
+
+	zone := config.Zone{
+		ZoneID: "zone123",
+		Subdomains: []config.Subdomain{
+			{Name: "good"},
+			{Name: "bad"},
+			{Name: "rejected"},
+		},
+	}
+
+	summary, err := ProcessZone(context.Background(), "token", zone, DetectedIPs{IPv4: "1.2.3.4"}, Options{DefaultTTL: 300, ConcurrencyLimit: 10})
+	if err != nil {
+		t.Fatalf("expected no zone-level error, got %v", err)
+	}
+
+	if got := summary.Count(Created); got != 1 {
+		t.Errorf("expected 1 created record, got %d", got)
+	}
+	if got := summary.Count(Failed); got != 2 {
+		t.Errorf("expected 2 failed records, got %d", got)
+	}
+	if len(summary.Records) != 3 || summary.Records[0].FQDN != "bad.example.com" || summary.Records[0].Err == nil {
+		t.Errorf("expected sorted results with the failure recorded, got %+v", summary.Records)
+	}
+	if r := summary.Records[len(summary.Records)-1]; r.Err == nil || !strings.Contains(r.Err.Error(), "1004 DNS Validation Error") {
+		t.Errorf("expected the success:false response to fail the record, got %+v", r)
+	}
+}
+
+func TestProcessZoneTemplatedContent(t *testing.T) {
+	var writes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/zones/zone123"):
+			w.Write([]byte(`{"success": true, "result": {"name": "example.com"}}`))
+		case r.Method == "GET":
+			// Every record currently holds the rendered content for 1.2.3.4.
+			resp := ListRecordsResponse{Success: true}
+			switch r.URL.Query().Get("name") {
+			case "spf.example.com":
+				resp.Result = []Record{{ID: "spf", Type: "TXT", Name: "spf.example.com", Content: `"v=spf1 ip4:1.2.3.4 -all"`, TTL: 300}}
+			case "ip.example.com":
+				resp.Result = []Record{{ID: "ip", Type: "TXT", Name: "ip.example.com", Content: "1.2.3.4", TTL: 300}}
+			case "stamp.example.com":
+				resp.Result = []Record{{ID: "stamp", Type: "TXT", Name: "stamp.example.com", Content: "1.2.3.4 since 2025-01-02T03:04:05Z", TTL: 300}}
+			}
+			data, _ := json.Marshal(resp)
+			w.Write(data)
+		default:
+			writes = append(writes, r.Method+" "+r.URL.Path)
+			w.Write([]byte(`{"success": true}`))
+		}
+	}))
+	defer server.Close()
+
+	originalClient := retry.HTTPClient
+	retry.HTTPClient = &http.Client{Transport: &mockTransport{server: server}}
+	defer func() { retry.HTTPClient = originalClient }()
+
+	zone := config.Zone{
+		ZoneID: "zone123",
+		Subdomains: []config.Subdomain{
+			{Name: "spf", Type: "SPF", Content: "v=spf1 ip4:{{.IPv4}} -all"},
+			{Name: "ip", Type: "TXT", Content: "{{.IPv4}}"},
+			{Name: "stamp", Type: "TXT", Content: "{{.IPv4}} since {{.Timestamp}}"},
+		},
+	}
+
+	summary, err := ProcessZone(context.Background(), "token", zone, DetectedIPs{IPv4: "1.2.3.4"}, Options{DefaultTTL: 300, ConcurrencyLimit: 1})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := summary.Count(Unchanged); got != 3 {
+		t.Errorf("expected 3 unchanged records, got %d: %+v", got, summary.Records)
+	}
+	if len(writes) != 0 {
+		t.Errorf("expected no writes, got %v", writes)
+	}
+
+	summary, err = ProcessZone(context.Background(), "token", zone, DetectedIPs{IPv4: "5.6.7.8"}, Options{DefaultTTL: 300, ConcurrencyLimit: 1})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := summary.Count(Updated); got != 3 {
+		t.Errorf("expected 3 updated records, got %d: %+v", got, summary.Records)
+	}
+}
+
+func TestProcessZoneTXTLeavesForeignRecords(t *testing.T) {
+	tests := []struct {
+		name       string
+		existing   []Record
+		wantWrites []string
+	}{
+		{
+			name: "updates the record rendered for the old address",
+			existing: []Record{
+				{ID: "spf", Type: "TXT", Name: "example.com", Content: `"v=spf1 include:_spf.google.com ~all"`, TTL: 300},
+				{ID: "verify", Type: "TXT", Name: "example.com", Content: `"google-site-verification=abc"`, TTL: 300},
+				{ID: "ip", Type: "TXT", Name: "example.com", Content: `"ip=5.6.7.8"`, TTL: 300},
+			},
+			wantWrites: []string{"PUT ip"},
+		},
+		{
+			name: "creates a new record next to foreign ones",
+			existing: []Record{
+				{ID: "spf", Type: "TXT", Name: "example.com", Content: `"v=spf1 include:_spf.google.com ~all"`, TTL: 300},
+				{ID: "verify", Type: "TXT", Name: "example.com", Content: `"google-site-verification=abc"`, TTL: 300},
+			},
+			wantWrites: []string{"POST dns_records"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var writes []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case strings.HasSuffix(r.URL.Path, "/zones/zone123"):
+					w.Write([]byte(`{"success": true, "result": {"name": "example.com"}}`))
+				case r.Method == "GET":
+					data, _ := json.Marshal(ListRecordsResponse{Success: true, Result: slices.Clone(tt.existing)})
+					w.Write(data)
+				default:
+					writes = append(writes, r.Method+" "+path.Base(r.URL.Path))
+					w.Write([]byte(`{"success": true}`))
+				}
+			}))
+			defer server.Close()
+
+			originalClient := retry.HTTPClient
+			retry.HTTPClient = &http.Client{Transport: &mockTransport{server: server}}
+			defer func() { retry.HTTPClient = originalClient }()
+
+			zone := config.Zone{ZoneID: "zone123", Subdomains: []config.Subdomain{{Name: "@", Type: "TXT", Content: "ip={{.IPv4}}"}}}
+			summary, err := ProcessZone(context.Background(), "token", zone, DetectedIPs{IPv4: "1.2.3.4"}, Options{DefaultTTL: 300, ConcurrencyLimit: 1})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(summary.Records) != 1 || summary.Records[0].Err != nil {
+				t.Errorf("expected a single successful result, got %+v", summary.Records)
+			}
+			if !slices.Equal(writes, tt.wantWrites) {
+				t.Errorf("writes = %v, want %v", writes, tt.wantWrites)
+			}
+		})
+	}
+}
+
+func TestUpsertRecordMetadataChanges(t *testing.T) {
+	existing := Record{ID: "rec123", Type: "A", Name: "www.example.com", Content: "1.2.3.4", TTL: 300, Comment: "old", Tags: []string{"b:2", "a:1"}}
+
+	var sent Record
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			data, _ := json.Marshal(ListRecordsResponse{Success: true, Result: []Record{existing}})
+			w.Write(data)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&sent)
+		w.Write([]byte(`{"success": true}`))
+	}))
+	defer server.Close()
+
+	originalClient := retry.HTTPClient
+	retry.HTTPClient = &http.Client{Transport: &mockTransport{server: server}}
+	defer func() { retry.HTTPClient = originalClient }()
+
+	tests := []struct {
+		name    string
+		comment string
+		tags    []string
+		want    Outcome
+	}{
+		{"same comment, tags reordered", "old", []string{"a:1", "b:2"}, Unchanged},
+		{"comment changed", ManagedComment, []string{"a:1", "b:2"}, Updated},
+		{"tag removed", "old", []string{"a:1"}, Updated},
+		{"unconfigured", "", nil, Unchanged},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desired := Record{Type: "A", Name: "www.example.com", Content: "1.2.3.4", TTL: 300, Comment: tt.comment, Tags: tt.tags}
+			result, err := upsertOne(context.Background(), "token", "zone123", desired, Options{})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if result.Outcome != tt.want {
+				t.Errorf("expected outcome %s, got %s", tt.want, result.Outcome)
+			}
+			if tt.want == Updated && (sent.Comment != tt.comment || len(sent.Tags) != len(tt.tags)) {
+				t.Errorf("update did not send comment and tags: %+v", sent)
+			}
+		})
+	}
+}
+
+func TestUpsertRecordKeepsUnconfiguredMetadata(t *testing.T) {
+	existing := Record{ID: "rec123", Type: "A", Name: "www.example.com", Content: "5.6.7.8", TTL: 300, Comment: "hand-written", Tags: []string{"team:ops"}}
+
+	var sent Record
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			data, _ := json.Marshal(ListRecordsResponse{Success: true, Result: []Record{existing}})
+			w.Write(data)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&sent)
+		w.Write([]byte(`{"success": true}`))
+	}))
+	defer server.Close()
+
+	originalClient := retry.HTTPClient
+	retry.HTTPClient = &http.Client{Transport: &mockTransport{server: server}}
+	defer func() { retry.HTTPClient = originalClient }()
+
+	desired := Record{Type: "A", Name: "www.example.com", Content: "1.2.3.4", TTL: 300}
+	result, err := upsertOne(context.Background(), "token", "zone123", desired, Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.Outcome != Updated {
+		t.Fatalf("expected the address change to update the record, got %s", result.Outcome)
+	}
+	if sent.Comment != "hand-written" || len(sent.Tags) != 1 || sent.Tags[0] != "team:ops" {
+		t.Errorf("expected the existing comment and tags to be kept, sent %+v", sent)
+	}
+}
@@ -0,0 +1,81 @@
+package cloudflare
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+type APIError struct {
+	StatusCode int
+	Code       int
+	Message    string
+	ErrorChain []ResponseInfo
+	Errors     []ResponseInfo
+}
+
+func newAPIError(statusCode int, errs []ResponseInfo) *APIError {
+	apiErr := &APIError{StatusCode: statusCode, Errors: errs}
+	if len(errs) > 0 {
+		apiErr.Code = errs[0].Code
+		apiErr.Message = errs[0].Message
+		apiErr.ErrorChain = errs[0].ErrorChain
+	}
+	return apiErr
+}
+
+func decodeAPIError(statusCode int, body []byte) *APIError {
+	var resp struct {
+		Errors []ResponseInfo `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &resp); err == nil && len(resp.Errors) > 0 {
+		return newAPIError(statusCode, resp.Errors)
+	}
+
+	return &APIError{StatusCode: statusCode, Message: strings.TrimSpace(string(body))}
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "cloudflare API error (HTTP %d)", e.StatusCode)
+
+	if len(e.Errors) == 0 {
+		if e.Message != "" {
+			b.WriteString(": " + e.Message)
+		}
+		return b.String()
+	}
+
+	for i, info := range e.Errors {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		writeResponseInfo(&b, info)
+	}
+	return b.String()
+}
+
+func writeResponseInfo(b *strings.Builder, info ResponseInfo) {
+	fmt.Fprintf(b, "%d %s", info.Code, info.Message)
+	for _, cause := range info.ErrorChain {
+		b.WriteString(" (caused by ")
+		writeResponseInfo(b, cause)
+		b.WriteString(")")
+	}
+}
+
+func ErrorDetails(err error) slog.Attr {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return slog.Attr{}
+	}
+
+	return slog.Group("cloudflare",
+		"status", apiErr.StatusCode,
+		"code", apiErr.Code,
+		"message", apiErr.Message)
+}
@@ -0,0 +1,125 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeAPIError(t *testing.T) {
+	tests := []struct {
+		name        string
+		statusCode  int
+		body        string
+		wantCode    int
+		wantMessage string
+		wantString  string
+	}{
+		{
+			name:        "single error",
+			statusCode:  http.StatusForbidden,
+			body:        `{"success":false,"errors":[{"code":9109,"message":"Invalid access token"}]}`,
+			wantCode:    9109,
+			wantMessage: "Invalid access token",
+			wantString:  "cloudflare API error (HTTP 403): 9109 Invalid access token",
+		},
+		{
+			name:        "error chain",
+			statusCode:  http.StatusBadRequest,
+			body:        `{"success":false,"errors":[{"code":1004,"message":"DNS Validation Error","error_chain":[{"code":9005,"message":"Content for A record is invalid."}]}]}`,
+			wantCode:    1004,
+			wantMessage: "DNS Validation Error",
+			wantString:  "cloudflare API error (HTTP 400): 1004 DNS Validation Error (caused by 9005 Content for A record is invalid.)",
+		},
+		{
+			name:        "multiple errors",
+			statusCode:  http.StatusBadRequest,
+			body:        `{"success":false,"errors":[{"code":81057,"message":"Record already exists."},{"code":81058,"message":"Record quota exceeded."}]}`,
+			wantCode:    81057,
+			wantMessage: "Record already exists.",
+			wantString:  "cloudflare API error (HTTP 400): 81057 Record already exists.; 81058 Record quota exceeded.",
+		},
+		{
+			name:        "non-json body",
+			statusCode:  http.StatusBadGateway,
+			body:        "<html>bad gateway</html>\n",
+			wantMessage: "<html>bad gateway</html>",
+			wantString:  "cloudflare API error (HTTP 502): <html>bad gateway</html>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiErr := decodeAPIError(tt.statusCode, []byte(tt.body))
+
+			if apiErr.StatusCode != tt.statusCode {
+				t.Errorf("StatusCode = %d, want %d", apiErr.StatusCode, tt.statusCode)
+			}
+			if apiErr.Code != tt.wantCode {
+				t.Errorf("Code = %d, want %d", apiErr.Code, tt.wantCode)
+			}
+			if apiErr.Message != tt.wantMessage {
+				t.Errorf("Message = %q, want %q", apiErr.Message, tt.wantMessage)
+			}
+			if got := apiErr.Error(); got != tt.wantString {
+				t.Errorf("Error() = %q, want %q", got, tt.wantString)
+			}
+		})
+	}
+}
+
+func TestCfAPIReturnsAPIError(t *testing.T) {
+	useFastRetries(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"success":false,"errors":[{"code":9109,"message":"Invalid access token"}]}`))
+	}))
+	defer server.Close()
+
+	_, err := cfAPI(context.Background(), "GET", server.URL, "bad-token", nil)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected APIError in chain, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusForbidden || apiErr.Code != 9109 {
+		t.Errorf("unexpected APIError: %+v", apiErr)
+	}
+}
+
+func TestUnmarshalErrorResponse(t *testing.T) {
+	var resp ListRecordsResponse
+	body := `{"success":false,"errors":[{"code":7003,"message":"Could not route to /zones/bad"}],"result":null}`
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("expected error response to unmarshal, got %v", err)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].Code != 7003 {
+		t.Errorf("unexpected errors: %+v", resp.Errors)
+	}
+}
+
+func TestErrorDetails(t *testing.T) {
+	plain := ErrorDetails(errors.New("boom"))
+	if !plain.Equal(slog.Attr{}) {
+		t.Errorf("expected empty attr for non-API error, got %v", plain)
+	}
+
+	wrapped := fmt.Errorf("update record: %w", newAPIError(http.StatusBadRequest, []ResponseInfo{{Code: 81058, Message: "Record quota exceeded."}}))
+	attr := ErrorDetails(wrapped)
+	if attr.Key != "cloudflare" {
+		t.Fatalf("expected cloudflare group, got %q", attr.Key)
+	}
+	if got := attr.Value.String(); !strings.Contains(got, "81058") || !strings.Contains(got, "Record quota exceeded.") {
+		t.Errorf("expected code and message in attr, got %s", got)
+	}
+}
@@ -0,0 +1,277 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/oberwager/cloudflare-ddns/internal/config"
+)
+
+// Ownership is tracked external-dns style: every managed record gets a TXT
+// registry record next to it naming the owner and the managed record's ID.
+const (
+	registryPrefix   = "_cf-ddns-"
+	registryHeritage = "heritage=cloudflare-ddns"
+)
+
+type registryEntry struct {
+	Record   Record
+	Owner    string
+	TargetID string
+}
+
+func registryKind(r Record) string {
+	if r.Type == "TXT" && isSPF(r) {
+		return "SPF"
+	}
+	return r.Type
+}
+
+func registryName(kind, fqdn string) string {
+	return registryPrefix + strings.ToLower(kind) + "." + fqdn
+}
+
+func registryContent(owner, id string) string {
+	return fmt.Sprintf("%s,owner=%s,id=%s", registryHeritage, owner, id)
+}
+
+// parseRegistry splits a registry name back into the managed record's kind
+// and name. ok is false for TXT records this tool didn't write.
+func parseRegistry(r Record) (entry registryEntry, kind, fqdn string, ok bool) {
+	rest, found := strings.CutPrefix(r.Name, registryPrefix)
+	if !found {
+		return entry, "", "", false
+	}
+	kind, fqdn, found = strings.Cut(rest, ".")
+	if !found || kind == "" || fqdn == "" {
+		return entry, "", "", false
+	}
+
+	parts := strings.Split(recordValue(r), ",")
+	if len(parts) == 0 || parts[0] != registryHeritage {
+		return entry, "", "", false
+	}
+	entry.Record = r
+	for _, part := range parts[1:] {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "owner":
+			entry.Owner = value
+		case "id":
+			entry.TargetID = value
+		}
+	}
+	if entry.Owner == "" || entry.TargetID == "" {
+		return entry, "", "", false
+	}
+
+	return entry, strings.ToUpper(kind), fqdn, true
+}
+
+// ownedKeys lists the kind/name pairs the config still asks for. Address
+// subdomains keep both families so a missing IPv6 address never prunes AAAA.
+// Other kinds come from registryKind on the desired record, as when writing
+// the registry, so a TXT subdomain holding an SPF policy keeps its SPF entry.
+func ownedKeys(subs []config.Subdomain, baseDomain string) map[string]bool {
+	keys := make(map[string]bool)
+	for _, s := range subs {
+		fqdn := subdomainFQDN(s.Name, baseDomain)
+		switch t := recordType(s); t {
+		case "A", "AAAA":
+			if s.Type == "" {
+				keys["A "+fqdn], keys["AAAA "+fqdn] = true, true
+			} else {
+				keys[t+" "+fqdn] = true
+			}
+		default:
+			desired, err := desiredRecords(s, fqdn, Addresses{}, 0, config.ContentData{})
+			if err != nil || len(desired) == 0 {
+				keys[t+" "+fqdn] = true
+				continue
+			}
+			keys[registryKind(desired[0])+" "+fqdn] = true
+		}
+	}
+	return keys
+}
+
+func listRegistry(ctx context.Context, token, zoneID string) ([]Record, error) {
+	var records []Record
+	for page := 1; ; page++ {
+		listURL := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records?type=TXT&name.startswith=%s&per_page=100&page=%d", zoneID, registryPrefix, page)
+		data, err := cfAPI(ctx, "GET", listURL, token, nil)
+		if err != nil {
+			return nil, fmt.Errorf("list registry records: %w", err)
+		}
+
+		var resp ListRecordsResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, fmt.Errorf("unmarshal list response: %w", err)
+		}
+		if !resp.Success {
+			return nil, fmt.Errorf("list registry records: %w", newAPIError(http.StatusOK, resp.Errors))
+		}
+
+		records = append(records, resp.Result...)
+		if page >= resp.ResultInfo.TotalPages {
+			return records, nil
+		}
+	}
+}
+
+// readRegistry returns the zone's registry entries keyed by kind and name.
+func readRegistry(ctx context.Context, token, zoneID string) (map[string]registryEntry, error) {
+	registry, err := listRegistry(ctx, token, zoneID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]registryEntry)
+	for _, r := range registry {
+		if entry, kind, fqdn, ok := parseRegistry(r); ok {
+			entries[kind+" "+fqdn] = entry
+		}
+	}
+	return entries, nil
+}
+
+// ownedIDs lists the IDs of the records registered to owner.
+func ownedIDs(entries map[string]registryEntry, owner string) map[string]bool {
+	ids := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Owner == owner {
+			ids[entry.TargetID] = true
+		}
+	}
+	return ids
+}
+
+// syncOwnership writes registry records for the records managed this run and,
+// when pruning, deletes owned records that are no longer configured.
+func syncOwnership(ctx context.Context, token string, zone config.Zone, baseDomain string, results []RecordResult, entries map[string]registryEntry, opts Options) []RecordResult {
+	var extra []RecordResult
+	fail := func(fqdn, recordType string, err error) {
+		slog.ErrorContext(ctx, "failed to update ownership of "+recordType+" record", "fqdn", fqdn, "error", err, ErrorDetails(err))
+		extra = append(extra, RecordResult{FQDN: fqdn, Type: recordType, Outcome: Failed, Err: err})
+	}
+
+	if !opts.DryRun {
+		// Only records created this run are registered. Registering one that
+		// already existed would let prune delete a record this tool never made.
+		for _, r := range results {
+			if r.Outcome != Created || r.New == nil || r.New.ID == "" {
+				continue
+			}
+			kind := registryKind(*r.New)
+			entry, exists := entries[kind+" "+r.FQDN]
+			if exists && entry.Owner != opts.Owner {
+				slog.WarnContext(ctx, "record is owned by another instance", "fqdn", r.FQDN, "type", kind, "owner", entry.Owner)
+				continue
+			}
+			if err := writeRegistry(ctx, token, zone.ZoneID, kind, r.FQDN, registryContent(opts.Owner, r.New.ID), entry.Record.ID); err != nil {
+				fail(r.FQDN, r.Type, err)
+			}
+		}
+	}
+
+	if !opts.Prune {
+		return extra
+	}
+
+	keep := ownedKeys(zone.Subdomains, baseDomain)
+	for key, entry := range entries {
+		if entry.Owner != opts.Owner || keep[key] {
+			continue
+		}
+		kind, fqdn, _ := strings.Cut(key, " ")
+		result, err := pruneRecord(ctx, token, zone.ZoneID, kind, fqdn, entry, opts.DryRun)
+		if err != nil {
+			fail(fqdn, kind, err)
+			continue
+		}
+		if result != nil {
+			extra = append(extra, *result)
+		}
+	}
+
+	return extra
+}
+
+func writeRegistry(ctx context.Context, token, zoneID, kind, fqdn, content, existingID string) error {
+	rec := Record{Type: "TXT", Name: registryName(kind, fqdn), Content: content, TTL: 1}
+	if existingID == "" {
+		createURL := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records", zoneID)
+		if _, err := cfWrite(ctx, "POST", createURL, token, rec); err != nil {
+			return fmt.Errorf("create registry record: %w", err)
+		}
+		return nil
+	}
+
+	updateURL := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records/%s", zoneID, existingID)
+	if _, err := cfWrite(ctx, "PUT", updateURL, token, rec); err != nil {
+		return fmt.Errorf("update registry record: %w", err)
+	}
+	return nil
+}
+
+// pruneRecord deletes an owned record and its registry entry. It returns a nil
+// result when the record was already gone and only the registry was cleaned up.
+func pruneRecord(ctx context.Context, token, zoneID, kind, fqdn string, entry registryEntry, dryRun bool) (*RecordResult, error) {
+	recordURL := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records/%s", zoneID, entry.TargetID)
+	registryURL := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records/%s", zoneID, entry.Record.ID)
+
+	data, err := cfAPI(ctx, "GET", recordURL, token, nil)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		slog.DebugContext(ctx, "owned record already deleted, removing registry entry", "fqdn", fqdn, "id", entry.TargetID)
+		if dryRun {
+			return nil, nil
+		}
+		if _, err := cfWrite(ctx, "DELETE", registryURL, token, nil); err != nil {
+			return nil, fmt.Errorf("delete registry record: %w", err)
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get record: %w", err)
+	}
+
+	var resp RecordResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("unmarshal record response: %w", err)
+	}
+	if !resp.Success {
+		return nil, fmt.Errorf("get record: %w", newAPIError(http.StatusOK, resp.Errors))
+	}
+	existing := resp.Result
+
+	// The ID came from a TXT record anyone with zone access could edit, so
+	// only delete it if it still points at the name and kind it was
+	// registered for.
+	if !strings.EqualFold(existing.Name, fqdn) {
+		return nil, fmt.Errorf("registry entry points at record %s named %q, refusing to delete", entry.TargetID, existing.Name)
+	}
+	if registryKind(existing) != kind {
+		return nil, fmt.Errorf("registry entry for %s points at %s record %s, refusing to delete", kind, registryKind(existing), entry.TargetID)
+	}
+
+	result := &RecordResult{FQDN: fqdn, Type: existing.Type, Outcome: Deleted, Old: &existing}
+	if dryRun {
+		slog.InfoContext(ctx, "would delete record", "fqdn", fqdn, "type", existing.Type, valueAttr("ip", existing))
+		return result, nil
+	}
+
+	if _, err := cfWrite(ctx, "DELETE", recordURL, token, nil); err != nil {
+		return nil, fmt.Errorf("delete record: %w", err)
+	}
+	if _, err := cfWrite(ctx, "DELETE", registryURL, token, nil); err != nil {
+		return nil, fmt.Errorf("delete registry record: %w", err)
+	}
+	slog.InfoContext(ctx, "deleted record", "fqdn", fqdn, "type", existing.Type, valueAttr("ip", existing))
+	return result, nil
+}
@@ -0,0 +1,256 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/oberwager/cloudflare-ddns/internal/config"
+	"github.com/oberwager/cloudflare-ddns/internal/retry"
+)
+
+func TestParseRegistry(t *testing.T) {
+	tests := []struct {
+		name     string
+		record   Record
+		wantOK   bool
+		wantKind string
+		wantFQDN string
+		wantID   string
+	}{
+		{
+			name:     "address record",
+			record:   Record{Type: "TXT", Name: "_cf-ddns-a.www.example.com", Content: registryContent("home", "rec1")},
+			wantOK:   true,
+			wantKind: "A",
+			wantFQDN: "www.example.com",
+			wantID:   "rec1",
+		},
+		{
+			name:     "quoted content",
+			record:   Record{Type: "TXT", Name: "_cf-ddns-spf.example.com", Content: `"` + registryContent("home", "rec2") + `"`},
+			wantOK:   true,
+			wantKind: "SPF",
+			wantFQDN: "example.com",
+			wantID:   "rec2",
+		},
+		{
+			name:   "unrelated TXT",
+			record: Record{Type: "TXT", Name: "_cf-ddns-a.www.example.com", Content: "hello"},
+		},
+		{
+			name:   "other prefix",
+			record: Record{Type: "TXT", Name: "_acme-challenge.example.com", Content: registryContent("home", "rec1")},
+		},
+		{
+			name:   "missing id",
+			record: Record{Type: "TXT", Name: "_cf-ddns-a.www.example.com", Content: "heritage=cloudflare-ddns,owner=home"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, kind, fqdn, ok := parseRegistry(tt.record)
+			if ok != tt.wantOK {
+				t.Fatalf("parseRegistry() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if kind != tt.wantKind || fqdn != tt.wantFQDN || entry.TargetID != tt.wantID || entry.Owner != "home" {
+				t.Errorf("parseRegistry() = %+v, %q, %q", entry, kind, fqdn)
+			}
+		})
+	}
+}
+
+func TestOwnedKeys(t *testing.T) {
+	keys := ownedKeys([]config.Subdomain{
+		{Name: "@"},
+		{Name: "v4", Type: "a"},
+		{Name: "mail", Type: "SPF"},
+		{Name: "txt", Type: "TXT", Content: "v=spf1 ip4:{{.IPv4}} -all"},
+		{Name: "ip", Type: "TXT", Content: "{{.IPv4}}"},
+	}, "example.com")
+
+	want := []string{"A example.com", "AAAA example.com", "A v4.example.com", "SPF mail.example.com", "SPF txt.example.com", "TXT ip.example.com"}
+	if len(keys) != len(want) {
+		t.Errorf("ownedKeys() = %v, want %v", keys, want)
+	}
+	for _, k := range want {
+		if !keys[k] {
+			t.Errorf("ownedKeys() missing %q", k)
+		}
+	}
+}
+
+// registryServer fakes the DNS records API for a zone holding one configured
+// record created by hand, one stale owned record, one record owned by another
+// instance, a registry entry whose record was deleted by hand and an A entry
+// tampered to point at an MX record.
+func registryServer(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	records := map[string]Record{
+		"www":   {ID: "www", Type: "A", Name: "www.example.com", Content: "1.2.3.4", TTL: 300},
+		"old":   {ID: "old", Type: "A", Name: "old.example.com", Content: "1.2.3.4", TTL: 300},
+		"other": {ID: "other", Type: "A", Name: "other.example.com", Content: "1.2.3.4", TTL: 300},
+		"reg-old": {ID: "reg-old", Type: "TXT", Name: "_cf-ddns-a.old.example.com",
+			Content: registryContent("default", "old")},
+		"reg-other": {ID: "reg-other", Type: "TXT", Name: "_cf-ddns-a.other.example.com",
+			Content: registryContent("laptop", "other")},
+		"reg-gone": {ID: "reg-gone", Type: "TXT", Name: "_cf-ddns-aaaa.gone.example.com",
+			Content: registryContent("default", "gone")},
+		"mail": {ID: "mail", Type: "MX", Name: "mail.example.com", Content: "mx.example.net", TTL: 300},
+		"reg-mail": {ID: "reg-mail", Type: "TXT", Name: "_cf-ddns-a.mail.example.com",
+			Content: registryContent("default", "mail")},
+	}
+
+	var mu sync.Mutex
+	var writes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		path := strings.TrimPrefix(r.URL.Path, "/client/v4/zones/zone123")
+		switch {
+		case path == "":
+			w.Write([]byte(`{"success": true, "result": {"name": "example.com"}}`))
+		case r.Method == "GET" && path == "/dns_records":
+			resp := ListRecordsResponse{Success: true}
+			for _, rec := range records {
+				prefix := r.URL.Query().Get("name.startswith")
+				if (prefix != "" && strings.HasPrefix(rec.Name, prefix)) || rec.Name == r.URL.Query().Get("name") {
+					resp.Result = append(resp.Result, rec)
+				}
+			}
+			resp.ResultInfo.Page, resp.ResultInfo.TotalPages = 1, 1
+			data, _ := json.Marshal(resp)
+			w.Write(data)
+		case r.Method == "GET":
+			rec, ok := records[strings.TrimPrefix(path, "/dns_records/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"success": false, "errors": [{"code": 81044, "message": "Record does not exist."}]}`))
+				return
+			}
+			data, _ := json.Marshal(map[string]any{"success": true, "result": rec})
+			w.Write(data)
+		default:
+			var body Record
+			json.NewDecoder(r.Body).Decode(&body)
+			writes = append(writes, strings.Join(strings.Fields(r.Method+" "+strings.TrimPrefix(path, "/dns_records")+" "+body.Name+" "+body.Content), " "))
+			w.Write([]byte(`{"success": true, "result": {"id": "new"}}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &writes
+}
+
+func TestProcessZonePrune(t *testing.T) {
+	server, writes := registryServer(t)
+
+	originalClient := retry.HTTPClient
+	retry.HTTPClient = &http.Client{Transport: &mockTransport{server: server}}
+	defer func() { retry.HTTPClient = originalClient }()
+
+	zone := config.Zone{ZoneID: "zone123", Subdomains: []config.Subdomain{{Name: "www", Type: "A"}, {Name: "new", Type: "A"}}}
+	opts := Options{DefaultTTL: 300, ConcurrencyLimit: 1, Owner: "default", Prune: true}
+
+	summary, err := ProcessZone(context.Background(), "token", zone, DetectedIPs{IPv4: "1.2.3.4"}, opts)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if got := summary.Count(Unchanged); got != 1 {
+		t.Errorf("expected 1 unchanged record, got %d: %+v", got, summary.Records)
+	}
+	if got := summary.Count(Created); got != 1 {
+		t.Errorf("expected 1 created record, got %d: %+v", got, summary.Records)
+	}
+	if got := summary.Count(Deleted); got != 1 {
+		t.Fatalf("expected 1 deleted record, got %d: %+v", got, summary.Records)
+	}
+	for _, r := range summary.Records {
+		if r.Outcome == Deleted && (r.FQDN != "old.example.com" || r.Old == nil || r.Old.ID != "old") {
+			t.Errorf("unexpected deleted record: %+v", r)
+		}
+	}
+	for _, r := range summary.Records {
+		if r.Outcome == Failed && (r.FQDN != "mail.example.com" || r.Err == nil || !strings.Contains(r.Err.Error(), "points at MX record")) {
+			t.Errorf("unexpected failure: %+v", r)
+		}
+	}
+	if got := summary.Count(Failed); got != 1 {
+		t.Errorf("expected the tampered entry to fail, got %d failures: %+v", got, summary.Records)
+	}
+
+	want := []string{
+		"POST new.example.com 1.2.3.4",
+		"POST _cf-ddns-a.new.example.com " + registryContent("default", "new"),
+		"DELETE /old",
+		"DELETE /reg-old",
+		"DELETE /reg-gone",
+	}
+	for _, w := range want {
+		if !slices.Contains(*writes, w) {
+			t.Errorf("expected write %q, got %v", w, *writes)
+		}
+	}
+	if len(*writes) != len(want) {
+		t.Errorf("expected %d writes, got %v", len(want), *writes)
+	}
+}
+
+func TestProcessZonePruneDryRun(t *testing.T) {
+	server, writes := registryServer(t)
+
+	originalClient := retry.HTTPClient
+	retry.HTTPClient = &http.Client{Transport: &mockTransport{server: server}}
+	defer func() { retry.HTTPClient = originalClient }()
+
+	zone := config.Zone{ZoneID: "zone123", Subdomains: []config.Subdomain{{Name: "www", Type: "A"}}}
+	opts := Options{DefaultTTL: 300, ConcurrencyLimit: 1, Owner: "default", Prune: true, DryRun: true}
+
+	summary, err := ProcessZone(context.Background(), "token", zone, DetectedIPs{IPv4: "1.2.3.4"}, opts)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := summary.Count(Deleted); got != 1 {
+		t.Errorf("expected 1 deleted record, got %d: %+v", got, summary.Records)
+	}
+	if len(*writes) != 0 {
+		t.Errorf("expected no writes in dry-run, got %v", *writes)
+	}
+}
+
+func TestProcessZoneOwnershipWithoutPrune(t *testing.T) {
+	server, writes := registryServer(t)
+
+	originalClient := retry.HTTPClient
+	retry.HTTPClient = &http.Client{Transport: &mockTransport{server: server}}
+	defer func() { retry.HTTPClient = originalClient }()
+
+	zone := config.Zone{ZoneID: "zone123", Subdomains: []config.Subdomain{{Name: "www", Type: "A"}, {Name: "new", Type: "A"}}}
+	opts := Options{DefaultTTL: 300, ConcurrencyLimit: 1, Owner: "default"}
+
+	summary, err := ProcessZone(context.Background(), "token", zone, DetectedIPs{IPv4: "1.2.3.4"}, opts)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := summary.Count(Deleted); got != 0 {
+		t.Errorf("expected no deleted records, got %d", got)
+	}
+
+	// The hand-made www record is managed but not registered.
+	want := []string{"POST new.example.com 1.2.3.4", "POST _cf-ddns-a.new.example.com " + registryContent("default", "new")}
+	if !slices.Equal(*writes, want) {
+		t.Errorf("writes = %v, want %v", *writes, want)
+	}
+}
@@ -0,0 +1,159 @@
+package cloudflare
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type planRecord struct {
+	Content string   `json:"content"`
+	Proxied bool     `json:"proxied"`
+	TTL     int      `json:"ttl"`
+	Comment string   `json:"comment,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+type planChange struct {
+	Action string      `json:"action"`
+	FQDN   string      `json:"fqdn"`
+	Type   string      `json:"type"`
+	Old    *planRecord `json:"old,omitempty"`
+	New    *planRecord `json:"new,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+type planZone struct {
+	ZoneID  string       `json:"zone_id"`
+	Domain  string       `json:"domain,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Changes []planChange `json:"changes"`
+}
+
+type plan struct {
+	ChangesPending bool       `json:"changes_pending"`
+	Create         int        `json:"create"`
+	Update         int        `json:"update"`
+	Unchanged      int        `json:"unchanged"`
+	Delete         int        `json:"delete"`
+	Failed         int        `json:"failed"`
+	Zones          []planZone `json:"zones"`
+}
+
+func (s *RunSummary) ChangesPending() bool {
+	t := s.Totals()
+	return t.Created+t.Updated+t.Deleted > 0
+}
+
+func (s *RunSummary) WritePlan(w io.Writer, format string) error {
+	switch format {
+	case "", "text":
+		return s.writeTextPlan(w)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s.plan())
+	default:
+		return fmt.Errorf("unknown plan format: %q", format)
+	}
+}
+
+func (s *RunSummary) plan() plan {
+	t := s.Totals()
+	p := plan{
+		ChangesPending: s.ChangesPending(),
+		Create:         t.Created,
+		Update:         t.Updated,
+		Unchanged:      t.Unchanged,
+		Delete:         t.Deleted,
+		Failed:         t.Failed,
+		Zones:          make([]planZone, 0, len(s.Zones)),
+	}
+
+	for _, z := range s.Zones {
+		pz := planZone{ZoneID: z.ZoneID, Domain: z.Domain, Changes: make([]planChange, 0, len(z.Records))}
+		if z.Err != nil {
+			pz.Error = z.Err.Error()
+		}
+		for _, r := range z.Records {
+			c := planChange{Action: planAction(r.Outcome), FQDN: r.FQDN, Type: r.Type}
+			if r.Old != nil {
+				c.Old = newPlanRecord(r.Old)
+			}
+			if r.New != nil && r.Outcome != Unchanged {
+				c.New = newPlanRecord(r.New)
+			}
+			if r.Err != nil {
+				c.Error = r.Err.Error()
+			}
+			pz.Changes = append(pz.Changes, c)
+		}
+		p.Zones = append(p.Zones, pz)
+	}
+
+	return p
+}
+
+func newPlanRecord(r *Record) *planRecord {
+	return &planRecord{Content: recordValue(*r), Proxied: r.Proxied, TTL: r.TTL, Comment: r.Comment, Tags: r.Tags}
+}
+
+func planAction(o Outcome) string {
+	switch o {
+	case Created:
+		return "create"
+	case Updated:
+		return "update"
+	case Unchanged:
+		return "no-op"
+	case Deleted:
+		return "delete"
+	default:
+		return "failed"
+	}
+}
+
+func (s *RunSummary) writeTextPlan(w io.Writer) error {
+	for _, z := range s.Zones {
+		name := z.Domain
+		if name == "" {
+			name = z.ZoneID
+		}
+		fmt.Fprintf(w, "Zone %s:\n", name)
+		if z.Err != nil {
+			fmt.Fprintf(w, "  ! %v\n", z.Err)
+		}
+
+		for _, r := range z.Records {
+			switch r.Outcome {
+			case Created:
+				fmt.Fprintf(w, "  + create %s %s %s\n", r.Type, r.FQDN, describeRecord(r.New))
+			case Updated:
+				fmt.Fprintf(w, "  ~ update %s %s %s -> %s\n", r.Type, r.FQDN, describeRecord(r.Old), describeRecord(r.New))
+			case Unchanged:
+				fmt.Fprintf(w, "  = no-op  %s %s %s\n", r.Type, r.FQDN, describeRecord(r.Old))
+			case Deleted:
+				fmt.Fprintf(w, "  - delete %s %s %s\n", r.Type, r.FQDN, describeRecord(r.Old))
+			default:
+				fmt.Fprintf(w, "  ! failed %s %s: %v\n", r.Type, r.FQDN, r.Err)
+			}
+		}
+	}
+
+	t := s.Totals()
+	_, err := fmt.Fprintf(w, "\nPlan: %d to create, %d to update, %d to delete, %d unchanged, %d failed.\n",
+		t.Created, t.Updated, t.Deleted, t.Unchanged, t.Failed)
+	return err
+}
+
+func describeRecord(r *Record) string {
+	if r == nil {
+		return "-"
+	}
+	ttl := strconv.Itoa(r.TTL)
+	if r.Proxied || r.TTL == 1 {
+		ttl = "auto"
+	}
+	return fmt.Sprintf("%s (proxied=%t, ttl=%s)", recordValue(*r), r.Proxied, ttl)
+}
@@ -0,0 +1,109 @@
+package cloudflare
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testPlanSummary() RunSummary {
+	return RunSummary{Zones: []ZoneSummary{
+		{
+			ZoneID: "z1",
+			Domain: "example.com",
+			Records: []RecordResult{
+				{
+					FQDN: "a.example.com", Type: "A", Outcome: Created,
+					New: &Record{Content: "1.2.3.4", Proxied: true, TTL: 300},
+				},
+				{
+					FQDN: "b.example.com", Type: "A", Outcome: Updated,
+					Old: &Record{Content: "5.6.7.8", TTL: 300},
+					New: &Record{Content: "1.2.3.4", TTL: 600},
+				},
+				{
+					FQDN: "c.example.com", Type: "A", Outcome: Unchanged,
+					Old: &Record{Content: "1.2.3.4", TTL: 300},
+					New: &Record{Content: "1.2.3.4", TTL: 300},
+				},
+				{FQDN: "d.example.com", Type: "AAAA", Outcome: Failed, Err: errors.New("boom")},
+			},
+		},
+	}}
+}
+
+func TestWritePlanText(t *testing.T) {
+	summary := testPlanSummary()
+
+	var buf bytes.Buffer
+	if err := summary.WritePlan(&buf, "text"); err != nil {
+		t.Fatalf("WritePlan() error = %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		"Zone example.com:",
+		"+ create A a.example.com 1.2.3.4 (proxied=true, ttl=auto)",
+		"~ update A b.example.com 5.6.7.8 (proxied=false, ttl=300) -> 1.2.3.4 (proxied=false, ttl=600)",
+		"= no-op  A c.example.com 1.2.3.4 (proxied=false, ttl=300)",
+		"! failed AAAA d.example.com: boom",
+		"Plan: 1 to create, 1 to update, 0 to delete, 1 unchanged, 1 failed.",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("plan output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWritePlanJSON(t *testing.T) {
+	summary := testPlanSummary()
+
+	var buf bytes.Buffer
+	if err := summary.WritePlan(&buf, "json"); err != nil {
+		t.Fatalf("WritePlan() error = %v", err)
+	}
+
+	var got plan
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON plan: %v", err)
+	}
+
+	if !got.ChangesPending || got.Create != 1 || got.Update != 1 || got.Unchanged != 1 || got.Failed != 1 {
+		t.Errorf("unexpected totals: %+v", got)
+	}
+	if len(got.Zones) != 1 || len(got.Zones[0].Changes) != 4 {
+		t.Fatalf("unexpected zones: %+v", got.Zones)
+	}
+
+	update := got.Zones[0].Changes[1]
+	if update.Action != "update" || update.Old.Content != "5.6.7.8" || update.New.TTL != 600 {
+		t.Errorf("unexpected update change: %+v", update)
+	}
+	if noop := got.Zones[0].Changes[2]; noop.New != nil {
+		t.Errorf("expected no new state for no-op, got %+v", noop.New)
+	}
+	if failed := got.Zones[0].Changes[3]; failed.Error != "boom" {
+		t.Errorf("expected error %q, got %q", "boom", failed.Error)
+	}
+}
+
+func TestWritePlanUnknownFormat(t *testing.T) {
+	summary := testPlanSummary()
+	if err := summary.WritePlan(&bytes.Buffer{}, "yaml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestChangesPending(t *testing.T) {
+	summary := RunSummary{Zones: []ZoneSummary{{Records: []RecordResult{{Outcome: Unchanged}}}}}
+	if summary.ChangesPending() {
+		t.Error("expected no pending changes")
+	}
+
+	summary.Zones[0].Records = append(summary.Zones[0].Records, RecordResult{Outcome: Updated})
+	if !summary.ChangesPending() {
+		t.Error("expected pending changes")
+	}
+}
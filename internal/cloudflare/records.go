@@ -0,0 +1,211 @@
+package cloudflare
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/oberwager/cloudflare-ddns/internal/config"
+)
+
+type RecordData struct {
+	Priority int    `json:"priority,omitempty"`
+	Weight   *int   `json:"weight,omitempty"`
+	Target   string `json:"target,omitempty"`
+	Value    string `json:"value,omitempty"`
+}
+
+func recordType(sub config.Subdomain) string {
+	if sub.Type == "" {
+		return "A"
+	}
+	return strings.ToUpper(sub.Type)
+}
+
+func isAddressType(t string) bool {
+	return t == "" || strings.EqualFold(t, "A") || strings.EqualFold(t, "AAAA")
+}
+
+func desiredRecords(sub config.Subdomain, fqdn string, addrs Addresses, ttl int, data config.ContentData) ([]Record, error) {
+	base := Record{Name: fqdn, TTL: ttl}
+	data.IPv4, data.IPv6 = addrs.IPv4, addrs.IPv6
+
+	switch t := strings.ToUpper(sub.Type); t {
+	case "", "A", "AAAA":
+		var records []Record
+		if addrs.IPv4 != "" && t != "AAAA" {
+			records = append(records, Record{Type: "A", Name: fqdn, Content: addrs.IPv4, Proxied: sub.Proxied, TTL: ttl})
+		}
+		if addrs.IPv6 != "" && t != "A" {
+			records = append(records, Record{Type: "AAAA", Name: fqdn, Content: addrs.IPv6, Proxied: sub.Proxied, TTL: ttl})
+		}
+		if len(records) == 0 {
+			// Fail rather than skip, so a record that can never be set shows up.
+			family := map[string]string{"": "IPv4 or IPv6", "A": "IPv4", "AAAA": "IPv6"}[t]
+			return nil, fmt.Errorf("no %s address detected, check CF_IPV6_ENABLED and the ip_source providers", family)
+		}
+		return records, nil
+	case "TXT":
+		content, err := render(sub.Content, data)
+		if err != nil {
+			return nil, err
+		}
+		base.Type, base.Content = "TXT", content
+	case "SPF":
+		content := sub.Content
+		if content == "" {
+			content = defaultSPF(addrs)
+		}
+		content, err := render(content, data)
+		if err != nil {
+			return nil, err
+		}
+		base.Type, base.Content = "TXT", content
+	case "HTTPS", "SVCB":
+		priority, target := sub.Priority, sub.Target
+		if priority == 0 {
+			priority = 1
+		}
+		if target == "" {
+			target = "."
+		}
+		base.Type = t
+		base.Data = &RecordData{Priority: priority, Target: target, Value: svcParams(sub.Params, addrs)}
+	case "URI":
+		target, err := render(sub.Content, data)
+		if err != nil {
+			return nil, err
+		}
+		priority, weight := sub.Priority, sub.Weight
+		base.Type = "URI"
+		base.Priority = &priority
+		base.Data = &RecordData{Weight: &weight, Target: target}
+	default:
+		return nil, fmt.Errorf("unsupported record type %q", sub.Type)
+	}
+
+	return []Record{base}, nil
+}
+
+func render(text string, data config.ContentData) (string, error) {
+	content, err := config.RenderContent(text, data)
+	if err != nil {
+		return "", fmt.Errorf("render content template: %w", err)
+	}
+	return content, nil
+}
+
+// recordMatcher decides which of the records already at a name a desired
+// record may take over.
+type recordMatcher struct {
+	pattern *regexp.Regexp
+	current *regexp.Regexp
+	owned   map[string]bool
+}
+
+// claims reports whether existing belongs to desired. A name often carries
+// TXT records for SPF, site verification and the like, so a plain TXT record
+// only claims records holding its value or one rendered from the same
+// template. The managed comment, tags and registry entries are shared by every
+// TXT record on the name, so they never decide which one is which.
+func (m recordMatcher) claims(existing, desired Record) bool {
+	switch {
+	case desired.Type != "TXT":
+		return true
+	case isSPF(desired) != isSPF(existing):
+		return false
+	case isSPF(desired), recordValue(existing) == recordValue(desired):
+		return true
+	}
+	return m.pattern != nil && m.pattern.MatchString(recordValue(existing))
+}
+
+// sameValue reports whether existing already holds desired's value. Content
+// rendered this run is compared without {{.Timestamp}}, so the timestamp
+// records when the content last changed rather than when the updater last ran.
+func (m recordMatcher) sameValue(existing, desired Record) bool {
+	if recordValue(existing) == recordValue(desired) {
+		return true
+	}
+	return desired.Type == "TXT" && m.current != nil && m.current.MatchString(recordValue(existing))
+}
+
+var contentPlaceholders = config.ContentData{IPv4: "\x00ipv4\x00", IPv6: "\x00ipv6\x00", Hostname: "\x00hostname\x00", Timestamp: "\x00timestamp\x00"}
+
+var contentWildcards = strings.NewReplacer(
+	contentPlaceholders.IPv4, `[0-9.]*`,
+	contentPlaceholders.IPv6, `[0-9a-fA-F:.]*`,
+	contentPlaceholders.Hostname, `[0-9A-Za-z.-]*`,
+	contentPlaceholders.Timestamp, `[0-9TZ:.+-]*`,
+)
+
+// contentPattern matches anything text renders to with data, where fields set
+// to their contentPlaceholders value may hold any value of that kind.
+func contentPattern(text string, data config.ContentData) *regexp.Regexp {
+	content, err := config.RenderContent(text, data)
+	if err != nil {
+		return nil
+	}
+	return regexp.MustCompile("^" + contentWildcards.Replace(regexp.QuoteMeta(content)) + "$")
+}
+
+func defaultSPF(addrs Addresses) string {
+	spf := "v=spf1"
+	if addrs.IPv4 != "" {
+		spf += " ip4:{{.IPv4}}"
+	}
+	if addrs.IPv6 != "" {
+		spf += " ip6:{{.IPv6}}"
+	}
+	return spf + " -all"
+}
+
+func svcParams(params string, addrs Addresses) string {
+	var parts []string
+	if p := strings.TrimSpace(params); p != "" {
+		parts = append(parts, p)
+	}
+	if addrs.IPv4 != "" {
+		parts = append(parts, fmt.Sprintf("ipv4hint=%q", addrs.IPv4))
+	}
+	if addrs.IPv6 != "" {
+		parts = append(parts, fmt.Sprintf("ipv6hint=%q", addrs.IPv6))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (r Record) Value() string {
+	return recordValue(r)
+}
+
+// recordValue renders the type-specific payload of a record as one string
+// so records can be compared and displayed regardless of type.
+func recordValue(r Record) string {
+	switch r.Type {
+	case "HTTPS", "SVCB":
+		if r.Data == nil {
+			return r.Content
+		}
+		return fmt.Sprintf("%d %s %s", r.Data.Priority, r.Data.Target, strings.ReplaceAll(r.Data.Value, `"`, ""))
+	case "URI":
+		if r.Data == nil {
+			return r.Content
+		}
+		var priority, weight int
+		if r.Priority != nil {
+			priority = *r.Priority
+		}
+		if r.Data.Weight != nil {
+			weight = *r.Data.Weight
+		}
+		return fmt.Sprintf("%d %d %s", priority, weight, r.Data.Target)
+	case "TXT":
+		// Cloudflare may return TXT content wrapped in quotes.
+		if len(r.Content) >= 2 && strings.HasPrefix(r.Content, `"`) && strings.HasSuffix(r.Content, `"`) {
+			return r.Content[1 : len(r.Content)-1]
+		}
+		return r.Content
+	default:
+		return r.Content
+	}
+}
@@ -0,0 +1,176 @@
+package cloudflare
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/oberwager/cloudflare-ddns/internal/config"
+)
+
+func intPtr(i int) *int { return &i }
+
+func TestDesiredRecords(t *testing.T) {
+	data := config.ContentData{Hostname: "router", Timestamp: "2025-01-02T03:04:05Z"}
+	both := Addresses{IPv4: "1.2.3.4", IPv6: "2001:db8::1"}
+
+	tests := []struct {
+		name  string
+		sub   config.Subdomain
+		addrs Addresses
+		want  []Record
+	}{
+		{
+			name:  "address records",
+			sub:   config.Subdomain{Proxied: true},
+			addrs: both,
+			want: []Record{
+				{Type: "A", Name: "www.example.com", Content: "1.2.3.4", Proxied: true, TTL: 300},
+				{Type: "AAAA", Name: "www.example.com", Content: "2001:db8::1", Proxied: true, TTL: 300},
+			},
+		},
+		{
+			name:  "AAAA only",
+			sub:   config.Subdomain{Type: "aaaa"},
+			addrs: both,
+			want:  []Record{{Type: "AAAA", Name: "www.example.com", Content: "2001:db8::1", TTL: 300}},
+		},
+		{
+			name:  "TXT template",
+			sub:   config.Subdomain{Type: "TXT", Content: "{{.Hostname}} ip={{.IPv4}} at {{.Timestamp}}"},
+			addrs: both,
+			want:  []Record{{Type: "TXT", Name: "www.example.com", Content: "router ip=1.2.3.4 at 2025-01-02T03:04:05Z", TTL: 300}},
+		},
+		{
+			name:  "default SPF",
+			sub:   config.Subdomain{Type: "SPF"},
+			addrs: both,
+			want:  []Record{{Type: "TXT", Name: "www.example.com", Content: "v=spf1 ip4:1.2.3.4 ip6:2001:db8::1 -all", TTL: 300}},
+		},
+		{
+			name:  "default SPF IPv4 only",
+			sub:   config.Subdomain{Type: "SPF"},
+			addrs: Addresses{IPv4: "1.2.3.4"},
+			want:  []Record{{Type: "TXT", Name: "www.example.com", Content: "v=spf1 ip4:1.2.3.4 -all", TTL: 300}},
+		},
+		{
+			name:  "custom SPF",
+			sub:   config.Subdomain{Type: "SPF", Content: "v=spf1 mx ip4:{{.IPv4}} ~all"},
+			addrs: both,
+			want:  []Record{{Type: "TXT", Name: "www.example.com", Content: "v=spf1 mx ip4:1.2.3.4 ~all", TTL: 300}},
+		},
+		{
+			name:  "HTTPS hints",
+			sub:   config.Subdomain{Type: "HTTPS", Params: `alpn="h2,h3"`},
+			addrs: both,
+			want: []Record{{Type: "HTTPS", Name: "www.example.com", TTL: 300, Data: &RecordData{
+				Priority: 1, Target: ".", Value: `alpn="h2,h3" ipv4hint="1.2.3.4" ipv6hint="2001:db8::1"`,
+			}}},
+		},
+		{
+			name:  "SVCB with target",
+			sub:   config.Subdomain{Type: "SVCB", Priority: 2, Target: "svc.example.com"},
+			addrs: Addresses{IPv6: "2001:db8::1"},
+			want: []Record{{Type: "SVCB", Name: "www.example.com", TTL: 300, Data: &RecordData{
+				Priority: 2, Target: "svc.example.com", Value: `ipv6hint="2001:db8::1"`,
+			}}},
+		},
+		{
+			name:  "URI",
+			sub:   config.Subdomain{Type: "URI", Content: "https://{{.IPv4}}:8443/", Priority: 10, Weight: 5},
+			addrs: both,
+			want: []Record{{Type: "URI", Name: "www.example.com", TTL: 300, Priority: intPtr(10), Data: &RecordData{
+				Weight: intPtr(5), Target: "https://1.2.3.4:8443/",
+			}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := desiredRecords(tt.sub, "www.example.com", tt.addrs, 300, data)
+			if err != nil {
+				t.Fatalf("desiredRecords() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("desiredRecords() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDesiredRecordsTemplateError(t *testing.T) {
+	sub := config.Subdomain{Type: "TXT", Content: "{{.Nope}}"}
+	if _, err := desiredRecords(sub, "www.example.com", Addresses{IPv4: "1.2.3.4"}, 300, config.ContentData{}); err == nil {
+		t.Error("expected error for unknown template field")
+	}
+}
+
+func TestDesiredRecordsMissingFamily(t *testing.T) {
+	tests := []struct {
+		name  string
+		sub   config.Subdomain
+		addrs Addresses
+	}{
+		{"AAAA with IPv6 disabled", config.Subdomain{Type: "AAAA"}, Addresses{IPv4: "1.2.3.4"}},
+		{"ip_source without IPv4 providers", config.Subdomain{Type: "A", IPSource: "vpn"}, Addresses{IPv6: "2001:db8::1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := desiredRecords(tt.sub, "www.example.com", tt.addrs, 300, config.ContentData{}); err == nil {
+				t.Errorf("expected an error, got %+v", got)
+			}
+		})
+	}
+}
+
+func TestRecordValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		record Record
+		want   string
+	}{
+		{"address", Record{Type: "A", Content: "1.2.3.4"}, "1.2.3.4"},
+		{"quoted TXT", Record{Type: "TXT", Content: `"v=spf1 -all"`}, "v=spf1 -all"},
+		{"unquoted TXT", Record{Type: "TXT", Content: "v=spf1 -all"}, "v=spf1 -all"},
+		{"HTTPS", Record{Type: "HTTPS", Data: &RecordData{Priority: 1, Target: ".", Value: `alpn="h2" ipv4hint="1.2.3.4"`}}, "1 . alpn=h2 ipv4hint=1.2.3.4"},
+		{"URI", Record{Type: "URI", Priority: intPtr(10), Data: &RecordData{Weight: intPtr(1), Target: "https://x/"}}, "10 1 https://x/"},
+	}
+
+	for _, tt := range tests {
+		if got := recordValue(tt.record); got != tt.want {
+			t.Errorf("%s: recordValue() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRecordMatcherClaims(t *testing.T) {
+	desired := Record{Type: "TXT", Name: "example.com", Content: "ip=1.2.3.4"}
+	match := recordMatcher{pattern: contentPattern("ip={{.IPv4}} {{.Timestamp}}", contentPlaceholders), owned: map[string]bool{"registered": true}}
+
+	tests := []struct {
+		name     string
+		existing Record
+		desired  Record
+		want     bool
+	}{
+		{"same value", Record{Type: "TXT", Content: `"ip=1.2.3.4"`}, desired, true},
+		{"earlier rendering", Record{Type: "TXT", Content: "ip=5.6.7.8 2025-01-02T03:04:05Z"}, desired, true},
+		{"registered", Record{ID: "registered", Type: "TXT", Content: "anything"}, desired, false},
+		{"managed comment", Record{Type: "TXT", Content: "anything", Comment: ManagedComment}, Record{Type: "TXT", Content: "ip=1.2.3.4", Comment: ManagedComment}, false},
+		{"shared tags", Record{Type: "TXT", Content: "anything", Tags: []string{"env:home"}}, Record{Type: "TXT", Content: "ip=1.2.3.4", Tags: []string{"env:home"}}, false},
+		{"SPF", Record{Type: "TXT", Content: "v=spf1 -all"}, desired, false},
+		{"managed SPF", Record{Type: "TXT", Content: "v=spf1 -all", Comment: ManagedComment}, Record{Type: "TXT", Content: "ip=1.2.3.4", Comment: ManagedComment}, false},
+		{"verification", Record{Type: "TXT", Content: "google-site-verification=abc"}, desired, false},
+		{"SPF only claims SPF", Record{Type: "TXT", Content: "ip=1.2.3.4"}, Record{Type: "TXT", Content: "v=spf1 ip4:1.2.3.4 -all"}, false},
+		{"SPF claims SPF", Record{Type: "TXT", Content: "v=spf1 ip4:5.6.7.8 -all"}, Record{Type: "TXT", Content: "v=spf1 ip4:1.2.3.4 -all"}, true},
+		{"other types claim everything", Record{Type: "A", Content: "5.6.7.8"}, Record{Type: "A", Content: "1.2.3.4"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := match.claims(tt.existing, tt.desired); got != tt.want {
+				t.Errorf("claims() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
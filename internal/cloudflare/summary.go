@@ -0,0 +1,144 @@
+package cloudflare
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+)
+
+type Outcome string
+
+const (
+	Created   Outcome = "created"
+	Updated   Outcome = "updated"
+	Unchanged Outcome = "unchanged"
+	Deleted   Outcome = "deleted"
+	Failed    Outcome = "failed"
+)
+
+type RecordResult struct {
+	FQDN    string
+	Type    string
+	Outcome Outcome
+	Err     error
+	Old     *Record
+	New     *Record
+}
+
+type ZoneSummary struct {
+	ZoneID  string
+	Domain  string
+	Records []RecordResult
+	Err     error
+}
+
+func (z *ZoneSummary) Count(outcome Outcome) int {
+	n := 0
+	for _, r := range z.Records {
+		if r.Outcome == outcome {
+			n++
+		}
+	}
+	return n
+}
+
+func (z *ZoneSummary) sortRecords() {
+	sort.Slice(z.Records, func(i, j int) bool {
+		if z.Records[i].FQDN != z.Records[j].FQDN {
+			return z.Records[i].FQDN < z.Records[j].FQDN
+		}
+		return z.Records[i].Type < z.Records[j].Type
+	})
+}
+
+type Status int
+
+const (
+	Success Status = iota
+	PartialFailure
+	TotalFailure
+)
+
+func (s Status) String() string {
+	switch s {
+	case Success:
+		return "success"
+	case PartialFailure:
+		return "partial_failure"
+	default:
+		return "total_failure"
+	}
+}
+
+type Totals struct {
+	Created     int
+	Updated     int
+	Unchanged   int
+	Deleted     int
+	Failed      int
+	FailedZones int
+}
+
+type RunSummary struct {
+	Zones []ZoneSummary
+
+	// DryRun marks a summary of changes that were planned but not made.
+	DryRun bool
+}
+
+func (s *RunSummary) Totals() Totals {
+	var t Totals
+	for i := range s.Zones {
+		z := &s.Zones[i]
+		if z.Err != nil {
+			t.FailedZones++
+		}
+		t.Created += z.Count(Created)
+		t.Updated += z.Count(Updated)
+		t.Unchanged += z.Count(Unchanged)
+		t.Deleted += z.Count(Deleted)
+		t.Failed += z.Count(Failed)
+	}
+	return t
+}
+
+func (s *RunSummary) Status() Status {
+	t := s.Totals()
+	if t.Failed == 0 && t.FailedZones == 0 {
+		return Success
+	}
+	if t.Created+t.Updated+t.Unchanged+t.Deleted == 0 {
+		return TotalFailure
+	}
+	return PartialFailure
+}
+
+// Log writes a line per zone and one for the run, with ctx so they carry the
+// run's trace ID.
+func (s *RunSummary) Log(ctx context.Context) {
+	for i := range s.Zones {
+		z := &s.Zones[i]
+		attrs := []any{"zone_id", z.ZoneID, "domain", z.Domain}
+		attrs = append(attrs, s.changeAttrs(z.Count(Created), z.Count(Updated), z.Count(Deleted))...)
+		attrs = append(attrs, "unchanged", z.Count(Unchanged), "failed", z.Count(Failed))
+		if z.Err != nil {
+			attrs = append(attrs, "error", z.Err)
+		}
+		slog.InfoContext(ctx, "zone summary", attrs...)
+	}
+
+	t := s.Totals()
+	attrs := []any{"status", s.Status().String(), "zones", len(s.Zones), "failed_zones", t.FailedZones}
+	attrs = append(attrs, s.changeAttrs(t.Created, t.Updated, t.Deleted)...)
+	attrs = append(attrs, "unchanged", t.Unchanged, "failed", t.Failed)
+	slog.InfoContext(ctx, "run summary", attrs...)
+}
+
+// changeAttrs names the change counts after what a dry run would do, so its
+// logs can't be mistaken for a run that changed records.
+func (s *RunSummary) changeAttrs(created, updated, deleted int) []any {
+	if s.DryRun {
+		return []any{"would_create", created, "would_update", updated, "would_delete", deleted}
+	}
+	return []any{"created", created, "updated", updated, "deleted", deleted}
+}
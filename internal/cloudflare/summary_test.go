@@ -0,0 +1,107 @@
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRunSummaryStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		zones []ZoneSummary
+		want  Status
+	}{
+		{
+			name:  "no zones",
+			zones: nil,
+			want:  Success,
+		},
+		{
+			name: "all succeeded",
+			zones: []ZoneSummary{
+				{ZoneID: "z1", Records: []RecordResult{{Outcome: Created}, {Outcome: Unchanged}}},
+				{ZoneID: "z2", Records: []RecordResult{{Outcome: Updated}}},
+			},
+			want: Success,
+		},
+		{
+			name: "some records failed",
+			zones: []ZoneSummary{
+				{ZoneID: "z1", Records: []RecordResult{{Outcome: Created}, {Outcome: Failed, Err: errors.New("boom")}}},
+			},
+			want: PartialFailure,
+		},
+		{
+			name: "one zone failed",
+			zones: []ZoneSummary{
+				{ZoneID: "z1", Records: []RecordResult{{Outcome: Unchanged}}},
+				{ZoneID: "z2", Err: errors.New("get zone: HTTP 403")},
+			},
+			want: PartialFailure,
+		},
+		{
+			name: "every record failed",
+			zones: []ZoneSummary{
+				{ZoneID: "z1", Records: []RecordResult{{Outcome: Failed}, {Outcome: Failed}}},
+			},
+			want: TotalFailure,
+		},
+		{
+			name: "every zone failed",
+			zones: []ZoneSummary{
+				{ZoneID: "z1", Err: errors.New("boom")},
+				{ZoneID: "z2", Err: errors.New("boom")},
+			},
+			want: TotalFailure,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := RunSummary{Zones: tt.zones}
+			if got := s.Status(); got != tt.want {
+				t.Errorf("Status() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunSummaryTotals(t *testing.T) {
+	s := RunSummary{Zones: []ZoneSummary{
+		{ZoneID: "z1", Records: []RecordResult{{Outcome: Created}, {Outcome: Updated}, {Outcome: Unchanged}}},
+		{ZoneID: "z2", Records: []RecordResult{{Outcome: Failed}, {Outcome: Unchanged}}},
+		{ZoneID: "z3", Err: errors.New("boom")},
+	}}
+
+	got := s.Totals()
+	want := Totals{Created: 1, Updated: 1, Unchanged: 2, Failed: 1, FailedZones: 1}
+	if got != want {
+		t.Errorf("Totals() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRunSummaryLogDryRun(t *testing.T) {
+	var buf bytes.Buffer
+	original := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(original) })
+
+	s := RunSummary{DryRun: true, Zones: []ZoneSummary{
+		{ZoneID: "z1", Records: []RecordResult{{Outcome: Created}, {Outcome: Updated}, {Outcome: Unchanged}}},
+	}}
+	s.Log(context.Background())
+
+	out := buf.String()
+	for _, want := range []string{"would_create=1", "would_update=1", "would_delete=0", "unchanged=1"} {
+		if strings.Count(out, want) != 2 {
+			t.Errorf("expected %q in the zone and run summaries, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, " created=") || strings.Contains(out, " updated=") {
+		t.Errorf("dry run logged changes as made:\n%s", out)
+	}
+}
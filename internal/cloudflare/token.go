@@ -0,0 +1,58 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+var ErrTokenInactive = errors.New("token is not active")
+
+// invalidTokenCode is the Cloudflare error code for an invalid API token.
+const invalidTokenCode = 1000
+
+type verifyTokenResponse struct {
+	Result struct {
+		Status string `json:"status"`
+	} `json:"result"`
+	Success bool           `json:"success"`
+	Errors  []ResponseInfo `json:"errors"`
+}
+
+// VerifyToken checks that an API token is active. Account-owned tokens can
+// only be verified against their account, so accountID must be set for them.
+func VerifyToken(ctx context.Context, token, accountID string) error {
+	verifyURL := "https://api.cloudflare.com/client/v4/user/tokens/verify"
+	if accountID != "" {
+		verifyURL = fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/tokens/verify", accountID)
+	}
+
+	data, err := cfAPI(ctx, "GET", verifyURL, token, nil)
+	var resp verifyTokenResponse
+	if err == nil {
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return fmt.Errorf("unmarshal verify response: %w", err)
+		}
+		if !resp.Success {
+			err = newAPIError(http.StatusOK, resp.Errors)
+		}
+	}
+
+	// The user endpoint rejects every account-owned token as invalid (1000),
+	// so without an account ID that answer doesn't mean the token is bad.
+	var apiErr *APIError
+	if accountID == "" && errors.As(err, &apiErr) && apiErr.Code == invalidTokenCode {
+		slog.WarnContext(ctx, "api token could not be verified, set CF_ACCOUNT_ID if it is an account-owned token", "error", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("verify token: %w", err)
+	}
+	if resp.Result.Status != "active" {
+		return fmt.Errorf("%w: status is %q", ErrTokenInactive, resp.Result.Status)
+	}
+	return nil
+}
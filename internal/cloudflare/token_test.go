@@ -0,0 +1,91 @@
+package cloudflare
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oberwager/cloudflare-ddns/internal/retry"
+)
+
+func TestVerifyToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		accountID string
+		status    int
+		body      string
+		wantErr   string
+	}{
+		{
+			name:   "active",
+			status: http.StatusOK,
+			body:   `{"success": true, "result": {"id": "tok", "status": "active"}}`,
+		},
+		{
+			name:      "account token",
+			accountID: "acc123",
+			status:    http.StatusOK,
+			body:      `{"success": true, "result": {"id": "tok", "status": "active"}}`,
+		},
+		{
+			name:    "disabled",
+			status:  http.StatusOK,
+			body:    `{"success": true, "result": {"id": "tok", "status": "disabled"}}`,
+			wantErr: `token is not active: status is "disabled"`,
+		},
+		{
+			name:      "invalid",
+			accountID: "acc123",
+			status:    http.StatusUnauthorized,
+			body:      `{"success": false, "errors": [{"code": 1000, "message": "Invalid API Token"}]}`,
+			wantErr:   "Invalid API Token",
+		},
+		{
+			// Account-owned tokens are always invalid on the user endpoint.
+			name:   "invalid without account ID",
+			status: http.StatusUnauthorized,
+			body:   `{"success": false, "errors": [{"code": 1000, "message": "Invalid API Token"}]}`,
+		},
+		{
+			name:    "rejected without account ID",
+			status:  http.StatusForbidden,
+			body:    `{"success": false, "errors": [{"code": 9109, "message": "Unauthorized to access requested resource"}]}`,
+			wantErr: "9109",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				want := "/client/v4/user/tokens/verify"
+				if tt.accountID != "" {
+					want = "/client/v4/accounts/" + tt.accountID + "/tokens/verify"
+				}
+				if r.URL.Path != want || r.Header.Get("Authorization") != "Bearer token" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			originalClient := retry.HTTPClient
+			retry.HTTPClient = &http.Client{Transport: &mockTransport{server: server}}
+			defer func() { retry.HTTPClient = originalClient }()
+
+			err := VerifyToken(context.Background(), "token", tt.accountID)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/oberwager/cloudflare-ddns/internal/config"
+)
+
+type ZoneInfo struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type ListZonesResponse struct {
+	Result     []ZoneInfo `json:"result"`
+	ResultInfo struct {
+		Page       int `json:"page"`
+		TotalPages int `json:"total_pages"`
+	} `json:"result_info"`
+	Success bool           `json:"success"`
+	Errors  []ResponseInfo `json:"errors"`
+}
+
+func LookupZoneID(ctx context.Context, token, name string) (string, error) {
+	name = normalizeName(name)
+
+	data, err := cfAPI(ctx, "GET", "https://api.cloudflare.com/client/v4/zones?name="+url.QueryEscape(name), token, nil)
+	if err != nil {
+		return "", fmt.Errorf("list zones: %w", err)
+	}
+
+	var resp ListZonesResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return "", fmt.Errorf("unmarshal zones response: %w", err)
+	}
+	if !resp.Success {
+		return "", fmt.Errorf("list zones: %w", newAPIError(http.StatusOK, resp.Errors))
+	}
+
+	switch len(resp.Result) {
+	case 0:
+		return "", fmt.Errorf("no zone named %q is visible to the API token", name)
+	case 1:
+		return resp.Result[0].ID, nil
+	default:
+		return "", fmt.Errorf("%d zones named %q are visible to the API token, set zone_id instead", len(resp.Result), name)
+	}
+}
+
+func ListZones(ctx context.Context, token string) ([]ZoneInfo, error) {
+	var zones []ZoneInfo
+	for page := 1; ; page++ {
+		data, err := cfAPI(ctx, "GET", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones?per_page=50&page=%d", page), token, nil)
+		if err != nil {
+			return nil, fmt.Errorf("list zones: %w", err)
+		}
+
+		var resp ListZonesResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, fmt.Errorf("unmarshal zones response: %w", err)
+		}
+		if !resp.Success {
+			return nil, fmt.Errorf("list zones: %w", newAPIError(http.StatusOK, resp.Errors))
+		}
+
+		zones = append(zones, resp.Result...)
+		if page >= resp.ResultInfo.TotalPages || len(resp.Result) == 0 {
+			return zones, nil
+		}
+	}
+}
+
+// AssignZones groups fully-qualified records under the accessible zone with
+// the longest matching name, so sub.example.com wins over example.com.
+func AssignZones(records []config.Subdomain, zones []ZoneInfo) ([]config.Zone, error) {
+	var result []config.Zone
+	index := make(map[string]int)
+	var errs []error
+
+	for _, rec := range records {
+		fqdn := normalizeName(rec.Name)
+
+		var match *ZoneInfo
+		for i := range zones {
+			name := normalizeName(zones[i].Name)
+			if fqdn != name && !strings.HasSuffix(fqdn, "."+name) {
+				continue
+			}
+			if match == nil || len(name) > len(normalizeName(match.Name)) {
+				match = &zones[i]
+			}
+		}
+		if match == nil {
+			errs = append(errs, fmt.Errorf("record %s is not in any zone visible to the API token", fqdn))
+			continue
+		}
+
+		sub := rec
+		sub.Name = "@"
+		if zoneName := normalizeName(match.Name); fqdn != zoneName {
+			sub.Name = strings.TrimSuffix(fqdn, "."+zoneName)
+		}
+
+		i, ok := index[match.ID]
+		if !ok {
+			i = len(result)
+			index[match.ID] = i
+			result = append(result, config.Zone{ZoneID: match.ID, Name: match.Name})
+		}
+		result[i].Subdomains = append(result[i].Subdomains, sub)
+	}
+
+	return result, errors.Join(errs...)
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+}
@@ -0,0 +1,129 @@
+package cloudflare
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/oberwager/cloudflare-ddns/internal/config"
+	"github.com/oberwager/cloudflare-ddns/internal/retry"
+)
+
+func TestLookupZoneID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/client/v4/zones" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		switch r.URL.Query().Get("name") {
+		case "example.com":
+			w.Write([]byte(`{"success": true, "result": [{"id": "zone123", "name": "example.com"}]}`))
+		case "shared.org":
+			w.Write([]byte(`{"success": true, "result": [{"id": "a", "name": "shared.org"}, {"id": "b", "name": "shared.org"}]}`))
+		default:
+			w.Write([]byte(`{"success": true, "result": []}`))
+		}
+	}))
+	defer server.Close()
+
+	originalClient := retry.HTTPClient
+	retry.HTTPClient = &http.Client{Transport: &mockTransport{server: server}}
+	defer func() { retry.HTTPClient = originalClient }()
+
+	ctx := context.Background()
+
+	id, err := LookupZoneID(ctx, "token", "Example.com.")
+	if err != nil {
+		t.Fatalf("LookupZoneID() error = %v", err)
+	}
+	if id != "zone123" {
+		t.Errorf("LookupZoneID() = %q, want %q", id, "zone123")
+	}
+
+	if _, err := LookupZoneID(ctx, "token", "missing.net"); err == nil || !strings.Contains(err.Error(), "no zone named") {
+		t.Errorf("expected no-match error, got %v", err)
+	}
+
+	if _, err := LookupZoneID(ctx, "token", "shared.org"); err == nil || !strings.Contains(err.Error(), "2 zones named") {
+		t.Errorf("expected ambiguous-match error, got %v", err)
+	}
+}
+
+func TestListZones(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		switch r.URL.Query().Get("page") {
+		case "1":
+			w.Write([]byte(`{"success": true, "result": [{"id": "z1", "name": "example.com"}], "result_info": {"page": 1, "total_pages": 2}}`))
+		case "2":
+			w.Write([]byte(`{"success": true, "result": [{"id": "z2", "name": "other.org"}], "result_info": {"page": 2, "total_pages": 2}}`))
+		default:
+			t.Errorf("unexpected page %q", r.URL.Query().Get("page"))
+		}
+	}))
+	defer server.Close()
+
+	originalClient := retry.HTTPClient
+	retry.HTTPClient = &http.Client{Transport: &mockTransport{server: server}}
+	defer func() { retry.HTTPClient = originalClient }()
+
+	zones, err := ListZones(context.Background(), "token")
+	if err != nil {
+		t.Fatalf("ListZones() error = %v", err)
+	}
+	if len(zones) != 2 || zones[0].ID != "z1" || zones[1].Name != "other.org" {
+		t.Errorf("unexpected zones: %+v", zones)
+	}
+}
+
+func TestAssignZones(t *testing.T) {
+	zones := []ZoneInfo{
+		{ID: "z1", Name: "example.com"},
+		{ID: "z2", Name: "lab.example.com"},
+		{ID: "z3", Name: "other.org"},
+	}
+	records := []config.Subdomain{
+		{Name: "home.example.com", Proxied: true},
+		{Name: "nas.lab.example.com", TTL: 120},
+		{Name: "Example.com."},
+		{Name: "vpn.other.org"},
+		{Name: "lab.example.com"},
+	}
+
+	got, err := AssignZones(records, zones)
+	if err != nil {
+		t.Fatalf("AssignZones() error = %v", err)
+	}
+
+	want := []config.Zone{
+		{ZoneID: "z1", Name: "example.com", Subdomains: []config.Subdomain{{Name: "home", Proxied: true}, {Name: "@"}}},
+		{ZoneID: "z2", Name: "lab.example.com", Subdomains: []config.Subdomain{{Name: "nas", TTL: 120}, {Name: "@"}}},
+		{ZoneID: "z3", Name: "other.org", Subdomains: []config.Subdomain{{Name: "vpn"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AssignZones() = %+v, want %+v", got, want)
+	}
+}
+
+func TestAssignZonesUnmatched(t *testing.T) {
+	zones := []ZoneInfo{{ID: "z1", Name: "example.com"}}
+	records := []config.Subdomain{{Name: "home.example.com"}, {Name: "home.notexample.com"}, {Name: "vpn.other.org"}}
+
+	_, err := AssignZones(records, zones)
+	if err == nil {
+		t.Fatal("AssignZones() expected error, got nil")
+	}
+	for _, want := range []string{"home.notexample.com", "vpn.other.org"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("AssignZones() error missing %q: %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "home.example.com") {
+		t.Errorf("AssignZones() error mentions matched record: %v", err)
+	}
+}
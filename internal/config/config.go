@@ -1,47 +1,382 @@
 package config
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strings"
+)
 
 type Subdomain struct {
-	Name    string `json:"name"`
-	Proxied bool   `json:"proxied"`
-	TTL     int    `json:"ttl,omitempty"`
+	Name     string   `json:"name"`
+	Type     string   `json:"type,omitempty"`
+	Proxied  bool     `json:"proxied"`
+	TTL      int      `json:"ttl,omitempty"`
+	Content  string   `json:"content,omitempty"`
+	IPSource string   `json:"ip_source,omitempty"`
+	Priority int      `json:"priority,omitempty"`
+	Weight   int      `json:"weight,omitempty"`
+	Target   string   `json:"target,omitempty"`
+	Params   string   `json:"params,omitempty"`
+	Comment  string   `json:"comment,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
 }
 
 type Zone struct {
-	ZoneID     string      `json:"zone_id"`
+	ZoneID     string      `json:"zone_id,omitempty"`
+	Name       string      `json:"zone,omitempty"`
 	Subdomains []Subdomain `json:"subdomains"`
 	TTL        int         `json:"ttl,omitempty"`
 }
 
+type IPProvider struct {
+	Type      string `json:"type"`
+	URL       string `json:"url,omitempty"`
+	Interface string `json:"interface,omitempty"`
+	Resolver  string `json:"resolver,omitempty"`
+	Server    string `json:"server,omitempty"`
+	Protocol  string `json:"protocol,omitempty"`
+	Gateway   string `json:"gateway,omitempty"`
+}
+
+type IPSource struct {
+	Name          string       `json:"name"`
+	IPv4Providers []IPProvider `json:"ipv4_providers,omitempty"`
+	IPv6Providers []IPProvider `json:"ipv6_providers,omitempty"`
+}
+
+type Notifier struct {
+	Type             string            `json:"type"`
+	URL              string            `json:"url,omitempty"`
+	Token            string            `json:"token,omitempty"`
+	ChatID           string            `json:"chat_id,omitempty"`
+	Headers          map[string]string `json:"headers,omitempty"`
+	Host             string            `json:"host,omitempty"`
+	Port             int               `json:"port,omitempty"`
+	TLS              string            `json:"tls,omitempty"`
+	Username         string            `json:"username,omitempty"`
+	Password         string            `json:"password,omitempty"`
+	From             string            `json:"from,omitempty"`
+	To               []string          `json:"to,omitempty"`
+	Template         string            `json:"template,omitempty"`
+	Events           []string          `json:"events,omitempty"`
+	FailureThreshold int               `json:"failure_threshold,omitempty"`
+}
+
 type Config struct {
-	Zones            []Zone `json:"zones"`
-	DefaultTTL       int    `json:"default_ttl,omitempty"`
-	ConcurrencyLimit int    `json:"concurrency_limit,omitempty"`
+	Zones            []Zone       `json:"zones,omitempty"`
+	Records          []Subdomain  `json:"records,omitempty"`
+	DefaultTTL       int          `json:"default_ttl,omitempty"`
+	ConcurrencyLimit int          `json:"concurrency_limit,omitempty"`
+	IPv4Providers    []IPProvider `json:"ipv4_providers,omitempty"`
+	IPv6Providers    []IPProvider `json:"ipv6_providers,omitempty"`
+	IPv4Quorum       int          `json:"ipv4_quorum,omitempty"`
+	IPv6Quorum       int          `json:"ipv6_quorum,omitempty"`
+	IPSources        []IPSource   `json:"ip_sources,omitempty"`
+	ManagedComment   bool         `json:"managed_comment,omitempty"`
+	OwnerID          string       `json:"owner_id,omitempty"`
+	Prune            bool         `json:"prune,omitempty"`
+	DuplicatePolicy  string       `json:"duplicate_policy,omitempty"`
+	Notifications    []Notifier   `json:"notifications,omitempty"`
+}
+
+type FieldError struct {
+	Path string
+	Line int
+	Err  error
+}
+
+func (e *FieldError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+func fieldError(path, format string, args ...any) error {
+	return &FieldError{Path: path, Err: fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))}
 }
 
 func Validate(cfg *Config) error {
-	if len(cfg.Zones) == 0 {
-		return fmt.Errorf("no zones configured")
+	var errs []error
+	if len(cfg.Zones) == 0 && len(cfg.Records) == 0 {
+		errs = append(errs, &FieldError{Path: "zones", Err: fmt.Errorf("no zones or records configured")})
+	}
+
+	sources := make(map[string]bool, len(cfg.IPSources))
+	for i, src := range cfg.IPSources {
+		path := fmt.Sprintf("ip_sources[%d]", i)
+		switch {
+		case src.Name == "":
+			errs = append(errs, fieldError(path, "missing name"))
+		case sources[src.Name]:
+			errs = append(errs, fieldError(path, "duplicate name %q", src.Name))
+		}
+		sources[src.Name] = true
+
+		if len(src.IPv4Providers) == 0 && len(src.IPv6Providers) == 0 {
+			errs = append(errs, fieldError(path, "no providers configured"))
+		}
+		errs = append(errs, validateProviders(path+".ipv4_providers", src.IPv4Providers, false)...)
+		errs = append(errs, validateProviders(path+".ipv6_providers", src.IPv6Providers, true)...)
 	}
 
 	for i, zone := range cfg.Zones {
-		if zone.ZoneID == "" {
-			return fmt.Errorf("zone[%d]: missing zone_id", i)
+		path := fmt.Sprintf("zones[%d]", i)
+		switch {
+		case zone.ZoneID == "" && zone.Name == "":
+			errs = append(errs, fieldError(path, "missing zone_id or zone"))
+		case zone.ZoneID != "" && zone.Name != "":
+			errs = append(errs, fieldError(path, "zone_id and zone are mutually exclusive"))
 		}
 		if len(zone.Subdomains) == 0 {
-			return fmt.Errorf("zone[%d]: no subdomains configured", i)
+			errs = append(errs, fieldError(path, "no subdomains configured"))
 		}
 		for j, sub := range zone.Subdomains {
-			if sub.TTL != 0 && (sub.TTL < 60 || sub.TTL > 86400) {
-				return fmt.Errorf("zone[%d].subdomain[%d]: TTL must be between 60 and 86400 or 0 for default", i, j)
-			}
+			errs = append(errs, validateSubdomain(fmt.Sprintf("zones[%d].subdomains[%d]", i, j), sub, sources)...)
+		}
+	}
+
+	for i, rec := range cfg.Records {
+		path := fmt.Sprintf("records[%d]", i)
+		if !strings.Contains(strings.Trim(rec.Name, ". "), ".") {
+			errs = append(errs, fieldError(path, "name must be a fully-qualified domain name"))
 		}
+		errs = append(errs, validateSubdomain(path, rec, sources)...)
+	}
+
+	// The owner is stored in a comma-separated key=value TXT record.
+	if strings.ContainsAny(cfg.OwnerID, ",= \t\n") {
+		errs = append(errs, fieldError("owner_id", "owner_id must not contain commas, '=' or whitespace"))
+	}
+
+	switch cfg.DuplicatePolicy {
+	case "", "delete_extra", "fail":
+	case "update_all":
+		// Every duplicate would get the same address, which Cloudflare rejects
+		// as an identical record.
+		if slices.ContainsFunc(allSubdomains(cfg), isAddressSubdomain) {
+			errs = append(errs, fieldError("duplicate_policy", "update_all cannot be used with A or AAAA records, Cloudflare rejects identical records"))
+		}
+	default:
+		errs = append(errs, fieldError("duplicate_policy", "unknown duplicate_policy %q, use delete_extra, update_all or fail", cfg.DuplicatePolicy))
+	}
+
+	for i, n := range cfg.Notifications {
+		errs = append(errs, validateNotifier(fmt.Sprintf("notifications[%d]", i), n)...)
 	}
 
 	if cfg.ConcurrencyLimit < 0 {
-		return fmt.Errorf("concurrency_limit must be positive")
+		errs = append(errs, &FieldError{Path: "concurrency_limit", Err: fmt.Errorf("concurrency_limit must be positive")})
+	}
+
+	errs = append(errs, validateProviders("ipv4_providers", cfg.IPv4Providers, false)...)
+	errs = append(errs, validateProviders("ipv6_providers", cfg.IPv6Providers, true)...)
+
+	if err := validateQuorum("ipv4_quorum", cfg.IPv4Quorum, len(cfg.IPv4Providers)); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateQuorum("ipv6_quorum", cfg.IPv6Quorum, len(cfg.IPv6Providers)); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+func allSubdomains(cfg *Config) []Subdomain {
+	subs := slices.Clone(cfg.Records)
+	for _, zone := range cfg.Zones {
+		subs = append(subs, zone.Subdomains...)
+	}
+	return subs
+}
+
+func isAddressSubdomain(sub Subdomain) bool {
+	t := strings.ToUpper(sub.Type)
+	return t == "" || t == "A" || t == "AAAA"
+}
+
+func validateSubdomain(path string, sub Subdomain, sources map[string]bool) []error {
+	var errs []error
+	if sub.TTL != 0 && (sub.TTL < 60 || sub.TTL > 86400) {
+		errs = append(errs, fieldError(path, "TTL must be between 60 and 86400 or 0 for default"))
 	}
 
+	recordType := strings.ToUpper(sub.Type)
+	switch recordType {
+	case "", "A", "AAAA":
+		if sub.Content != "" && sub.IPSource != "" {
+			errs = append(errs, fieldError(path, "content and ip_source are mutually exclusive"))
+		}
+		if sub.Content != "" {
+			ip := net.ParseIP(sub.Content)
+			switch {
+			case ip == nil:
+				errs = append(errs, fieldError(path, "content must be an IP address"))
+			case recordType == "A" && ip.To4() == nil, recordType == "AAAA" && ip.To4() != nil:
+				errs = append(errs, fieldError(path, "content %s does not match record type %s", sub.Content, recordType))
+			}
+		}
+	case "TXT", "URI", "SPF":
+		if sub.Content == "" && recordType != "SPF" {
+			errs = append(errs, fieldError(path, "%s records require content", recordType))
+		}
+		if err := validateContent(sub.Content); err != nil {
+			errs = append(errs, fieldError(path, "invalid content template: %v", err))
+		}
+	case "HTTPS", "SVCB":
+	default:
+		errs = append(errs, fieldError(path, "unsupported record type %q", sub.Type))
+	}
+
+	if sub.Proxied && recordType != "" && recordType != "A" && recordType != "AAAA" {
+		errs = append(errs, fieldError(path, "%s records cannot be proxied", recordType))
+	}
+	if sub.Priority < 0 || sub.Priority > 65535 || sub.Weight < 0 || sub.Weight > 65535 {
+		errs = append(errs, fieldError(path, "priority and weight must be between 0 and 65535"))
+	}
+	if sub.IPSource != "" && !sources[sub.IPSource] {
+		errs = append(errs, fieldError(path, "unknown ip_source %q", sub.IPSource))
+	}
+	if len(sub.Comment) > 100 {
+		errs = append(errs, fieldError(path, "comment must be at most 100 characters"))
+	}
+	for _, tag := range sub.Tags {
+		if name, _, _ := strings.Cut(tag, ":"); strings.TrimSpace(name) == "" {
+			errs = append(errs, fieldError(path, "invalid tag %q, expected name:value", tag))
+		}
+	}
+	return errs
+}
+
+func validateProviders(field string, providers []IPProvider, isIPv6 bool) []error {
+	var errs []error
+	for i, p := range providers {
+		path := fmt.Sprintf("%s[%d]", field, i)
+		switch p.Type {
+		case "ipify", "icanhazip", "cloudflare", "interface":
+		case "aws":
+			if isIPv6 {
+				errs = append(errs, fieldError(path, "aws does not support IPv6"))
+			}
+		case "dns":
+			if p.Resolver != "" && p.Resolver != "opendns" && p.Resolver != "cloudflare" {
+				errs = append(errs, fieldError(path, "unknown dns resolver %q", p.Resolver))
+			}
+			if p.Server != "" {
+				if _, _, err := net.SplitHostPort(p.Server); err != nil {
+					errs = append(errs, fieldError(path, "server must be host:port"))
+				}
+			}
+		case "gateway":
+			if isIPv6 {
+				errs = append(errs, fieldError(path, "gateway does not support IPv6"))
+			}
+			if p.Protocol != "" && p.Protocol != "upnp" && p.Protocol != "natpmp" {
+				errs = append(errs, fieldError(path, "unknown gateway protocol %q", p.Protocol))
+			}
+			if p.Gateway != "" && net.ParseIP(p.Gateway) == nil {
+				if _, _, err := net.SplitHostPort(p.Gateway); err != nil {
+					errs = append(errs, fieldError(path, "gateway must be an IP address"))
+				}
+			}
+		case "custom":
+			u, err := url.Parse(p.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, fieldError(path, "custom provider requires an http(s) url"))
+			}
+		case "":
+			errs = append(errs, fieldError(path, "missing type"))
+		default:
+			errs = append(errs, fieldError(path, "unknown type %q", p.Type))
+		}
+	}
+
+	return errs
+}
+
+func validateNotifier(path string, n Notifier) []error {
+	var errs []error
+	switch n.Type {
+	case "webhook", "slack", "discord", "ntfy":
+		if !isHTTPURL(n.URL) {
+			errs = append(errs, fieldError(path, "%s notifier requires an http(s) url", n.Type))
+		}
+	case "gotify":
+		if !isHTTPURL(n.URL) {
+			errs = append(errs, fieldError(path, "gotify notifier requires an http(s) url"))
+		}
+		if n.Token == "" {
+			errs = append(errs, fieldError(path, "gotify notifier requires a token"))
+		}
+	case "telegram":
+		if n.Token == "" || n.ChatID == "" {
+			errs = append(errs, fieldError(path, "telegram notifier requires a token and chat_id"))
+		}
+		if n.URL != "" && !isHTTPURL(n.URL) {
+			errs = append(errs, fieldError(path, "url must be an http(s) url"))
+		}
+	case "email":
+		if n.Host == "" || n.From == "" || len(n.To) == 0 {
+			errs = append(errs, fieldError(path, "email notifier requires host, from and to"))
+		}
+		if n.Port < 0 || n.Port > 65535 {
+			errs = append(errs, fieldError(path, "port must be between 1 and 65535"))
+		}
+		if n.TLS != "" && n.TLS != "starttls" && n.TLS != "tls" && n.TLS != "none" {
+			errs = append(errs, fieldError(path, "unknown tls mode %q, use starttls, tls or none", n.TLS))
+		}
+		for _, addr := range append([]string{n.From}, n.To...) {
+			if _, err := mail.ParseAddress(addr); addr != "" && err != nil {
+				errs = append(errs, fieldError(path, "invalid address %q", addr))
+			}
+		}
+	case "":
+		errs = append(errs, fieldError(path, "missing type"))
+	default:
+		errs = append(errs, fieldError(path, "unknown type %q", n.Type))
+	}
+
+	if n.FailureThreshold < 0 {
+		errs = append(errs, fieldError(path, "failure_threshold must be positive"))
+	}
+	for _, event := range n.Events {
+		if event != "change" && event != "failure" {
+			errs = append(errs, fieldError(path, "unknown event %q, use change or failure", event))
+		}
+	}
+	return errs
+}
+
+// isHTTPURL reports whether raw is an absolute http(s) URL. Values that are
+// expanded from the environment when notifiers are built are accepted as is.
+func isHTTPURL(raw string) bool {
+	if strings.HasPrefix(raw, "$") {
+		return true
+	}
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func validateQuorum(field string, quorum, providers int) error {
+	if quorum == 0 {
+		return nil
+	}
+	if quorum < 0 {
+		return &FieldError{Path: field, Err: fmt.Errorf("%s must be positive", field)}
+	}
+	if quorum > providers {
+		return &FieldError{Path: field, Err: fmt.Errorf("%s of %d exceeds the %d configured providers", field, quorum, providers)}
+	}
+	if quorum*2 <= providers {
+		return &FieldError{Path: field, Err: fmt.Errorf("%s of %d is not a majority of %d providers", field, quorum, providers)}
+	}
 	return nil
 }
@@ -50,7 +50,7 @@ func TestValidate(t *testing.T) {
 			name:    "no zones",
 			config:  Config{},
 			wantErr: true,
-			errMsg:  "no zones configured",
+			errMsg:  "no zones or records configured",
 		},
 		{
 			name: "missing zone_id",
@@ -193,6 +193,480 @@ func TestValidate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid ip providers",
+			config: Config{
+				Zones: []Zone{
+					{
+						ZoneID:     "zone123",
+						Subdomains: []Subdomain{{Name: "www"}},
+					},
+				},
+				IPv4Providers: []IPProvider{{Type: "ipify"}, {Type: "aws"}, {Type: "custom", URL: "https://ip.example.com"}, {Type: "dns", Resolver: "cloudflare"}, {Type: "gateway", Protocol: "natpmp", Gateway: "192.168.1.1"}},
+				IPv6Providers: []IPProvider{{Type: "interface", Interface: "eth0"}, {Type: "cloudflare"}, {Type: "icanhazip"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown ip provider",
+			config: Config{
+				Zones: []Zone{
+					{
+						ZoneID:     "zone123",
+						Subdomains: []Subdomain{{Name: "www"}},
+					},
+				},
+				IPv4Providers: []IPProvider{{Type: "ipify"}, {Type: "whatismyip"}},
+			},
+			wantErr: true,
+			errMsg:  `ipv4_providers[1]: unknown type "whatismyip"`,
+		},
+		{
+			name: "custom ip provider without url",
+			config: Config{
+				Zones: []Zone{
+					{
+						ZoneID:     "zone123",
+						Subdomains: []Subdomain{{Name: "www"}},
+					},
+				},
+				IPv4Providers: []IPProvider{{Type: "custom"}},
+			},
+			wantErr: true,
+			errMsg:  "custom provider requires an http(s) url",
+		},
+		{
+			name: "unknown dns resolver",
+			config: Config{
+				Zones: []Zone{
+					{
+						ZoneID:     "zone123",
+						Subdomains: []Subdomain{{Name: "www"}},
+					},
+				},
+				IPv4Providers: []IPProvider{{Type: "dns", Resolver: "google"}},
+			},
+			wantErr: true,
+			errMsg:  `unknown dns resolver "google"`,
+		},
+		{
+			name: "gateway ip provider for ipv6",
+			config: Config{
+				Zones: []Zone{
+					{
+						ZoneID:     "zone123",
+						Subdomains: []Subdomain{{Name: "www"}},
+					},
+				},
+				IPv6Providers: []IPProvider{{Type: "gateway"}},
+			},
+			wantErr: true,
+			errMsg:  "gateway does not support IPv6",
+		},
+		{
+			name: "aws ip provider for ipv6",
+			config: Config{
+				Zones: []Zone{
+					{
+						ZoneID:     "zone123",
+						Subdomains: []Subdomain{{Name: "www"}},
+					},
+				},
+				IPv6Providers: []IPProvider{{Type: "aws"}},
+			},
+			wantErr: true,
+			errMsg:  "aws does not support IPv6",
+		},
+		{
+			name: "valid quorum",
+			config: Config{
+				Zones: []Zone{
+					{
+						ZoneID:     "zone123",
+						Subdomains: []Subdomain{{Name: "www"}},
+					},
+				},
+				IPv4Providers: []IPProvider{{Type: "ipify"}, {Type: "cloudflare"}, {Type: "aws"}},
+				IPv4Quorum:    2,
+			},
+			wantErr: false,
+		},
+		{
+			name: "quorum exceeds providers",
+			config: Config{
+				Zones: []Zone{
+					{
+						ZoneID:     "zone123",
+						Subdomains: []Subdomain{{Name: "www"}},
+					},
+				},
+				IPv6Providers: []IPProvider{{Type: "ipify"}, {Type: "cloudflare"}},
+				IPv6Quorum:    3,
+			},
+			wantErr: true,
+			errMsg:  "ipv6_quorum of 3 exceeds the 2 configured providers",
+		},
+		{
+			name: "quorum is not a majority",
+			config: Config{
+				Zones: []Zone{
+					{
+						ZoneID:     "zone123",
+						Subdomains: []Subdomain{{Name: "www"}},
+					},
+				},
+				IPv4Providers: []IPProvider{{Type: "ipify"}, {Type: "cloudflare"}, {Type: "aws"}, {Type: "icanhazip"}},
+				IPv4Quorum:    2,
+			},
+			wantErr: true,
+			errMsg:  "not a majority",
+		},
+		{
+			name: "valid content and ip source",
+			config: Config{
+				IPSources: []IPSource{
+					{Name: "vpn", IPv4Providers: []IPProvider{{Type: "interface", Interface: "wg0"}}},
+				},
+				Zones: []Zone{
+					{
+						ZoneID: "zone123",
+						Subdomains: []Subdomain{
+							{Name: "nas", Content: "192.0.2.10"},
+							{Name: "nas6", Content: "2001:db8::10"},
+							{Name: "vpn", IPSource: "vpn"},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid content",
+			config: Config{
+				Zones: []Zone{
+					{
+						ZoneID:     "zone123",
+						Subdomains: []Subdomain{{Name: "nas", Content: "nas.local"}},
+					},
+				},
+			},
+			wantErr: true,
+			errMsg:  "content must be an IP address",
+		},
+		{
+			name: "content and ip source together",
+			config: Config{
+				IPSources: []IPSource{
+					{Name: "vpn", IPv4Providers: []IPProvider{{Type: "interface", Interface: "wg0"}}},
+				},
+				Zones: []Zone{
+					{
+						ZoneID:     "zone123",
+						Subdomains: []Subdomain{{Name: "vpn", Content: "192.0.2.10", IPSource: "vpn"}},
+					},
+				},
+			},
+			wantErr: true,
+			errMsg:  "content and ip_source are mutually exclusive",
+		},
+		{
+			name: "unknown ip source",
+			config: Config{
+				Zones: []Zone{
+					{
+						ZoneID:     "zone123",
+						Subdomains: []Subdomain{{Name: "vpn", IPSource: "vpn"}},
+					},
+				},
+			},
+			wantErr: true,
+			errMsg:  `unknown ip_source "vpn"`,
+		},
+		{
+			name: "duplicate ip source",
+			config: Config{
+				IPSources: []IPSource{
+					{Name: "vpn", IPv4Providers: []IPProvider{{Type: "interface", Interface: "wg0"}}},
+					{Name: "vpn", IPv4Providers: []IPProvider{{Type: "interface", Interface: "wg1"}}},
+				},
+				Zones: []Zone{
+					{
+						ZoneID:     "zone123",
+						Subdomains: []Subdomain{{Name: "www"}},
+					},
+				},
+			},
+			wantErr: true,
+			errMsg:  `ip_sources[1]: duplicate name "vpn"`,
+		},
+		{
+			name: "ip source without providers",
+			config: Config{
+				IPSources: []IPSource{{Name: "vpn"}},
+				Zones: []Zone{
+					{
+						ZoneID:     "zone123",
+						Subdomains: []Subdomain{{Name: "www"}},
+					},
+				},
+			},
+			wantErr: true,
+			errMsg:  "ip_sources[0]: no providers configured",
+		},
+		{
+			name: "ip source with invalid provider",
+			config: Config{
+				IPSources: []IPSource{
+					{Name: "vpn", IPv6Providers: []IPProvider{{Type: "aws"}}},
+				},
+				Zones: []Zone{
+					{
+						ZoneID:     "zone123",
+						Subdomains: []Subdomain{{Name: "www"}},
+					},
+				},
+			},
+			wantErr: true,
+			errMsg:  "ip_sources[0].ipv6_providers[0]: aws does not support IPv6",
+		},
+		{
+			name: "zone by name",
+			config: Config{
+				Zones: []Zone{{Name: "example.com", Subdomains: []Subdomain{{Name: "www"}}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "zone_id and zone both set",
+			config: Config{
+				Zones: []Zone{{ZoneID: "zone123", Name: "example.com", Subdomains: []Subdomain{{Name: "www"}}}},
+			},
+			wantErr: true,
+			errMsg:  "zone_id and zone are mutually exclusive",
+		},
+		{
+			name: "records without zones",
+			config: Config{
+				Records: []Subdomain{{Name: "home.example.com", Proxied: true}, {Name: "vpn.other.org", TTL: 120}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "record name not fully qualified",
+			config: Config{
+				Records: []Subdomain{{Name: "home"}},
+			},
+			wantErr: true,
+			errMsg:  "records[0]: name must be a fully-qualified domain name",
+		},
+		{
+			name: "record with invalid TTL",
+			config: Config{
+				Records: []Subdomain{{Name: "home.example.com", TTL: 30}},
+			},
+			wantErr: true,
+			errMsg:  "records[0]: TTL must be between 60 and 86400",
+		},
+		{
+			name: "valid record types",
+			config: Config{
+				Zones: []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{
+					{Name: "www", Type: "A"},
+					{Name: "www", Type: "https", Params: `alpn="h2"`},
+					{Name: "_dns", Type: "SVCB", Priority: 2, Target: "dns.example.com"},
+					{Name: "@", Type: "SPF"},
+					{Name: "ip", Type: "TXT", Content: "{{.IPv4}}"},
+					{Name: "_http._tcp", Type: "URI", Content: "http://{{.IPv4}}/", Priority: 10, Weight: 1},
+				}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unsupported record type",
+			config: Config{
+				Zones: []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "www", Type: "MX"}}}},
+			},
+			wantErr: true,
+			errMsg:  `unsupported record type "MX"`,
+		},
+		{
+			name: "TXT without content",
+			config: Config{
+				Zones: []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "ip", Type: "TXT"}}}},
+			},
+			wantErr: true,
+			errMsg:  "TXT records require content",
+		},
+		{
+			name: "proxied HTTPS record",
+			config: Config{
+				Zones: []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "www", Type: "HTTPS", Proxied: true}}}},
+			},
+			wantErr: true,
+			errMsg:  "HTTPS records cannot be proxied",
+		},
+		{
+			name: "content family does not match type",
+			config: Config{
+				Zones: []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "nas", Type: "AAAA", Content: "192.168.1.20"}}}},
+			},
+			wantErr: true,
+			errMsg:  "content 192.168.1.20 does not match record type AAAA",
+		},
+		{
+			name: "content template with unknown field",
+			config: Config{
+				Zones: []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "ip", Type: "TXT", Content: "{{.IPV4}}"}}}},
+			},
+			wantErr: true,
+			errMsg:  "invalid content template",
+		},
+		{
+			name: "content template syntax error",
+			config: Config{
+				Zones: []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "@", Type: "SPF", Content: "v=spf1 ip4:{{.IPv4 -all"}}}},
+			},
+			wantErr: true,
+			errMsg:  "invalid content template",
+		},
+		{
+			name: "comment and tags",
+			config: Config{
+				ManagedComment: true,
+				Zones:          []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "www", Comment: "home router", Tags: []string{"env:home", "owner:ddns"}}}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "tag without name",
+			config: Config{
+				Zones: []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "www", Tags: []string{":value"}}}}},
+			},
+			wantErr: true,
+			errMsg:  `invalid tag ":value"`,
+		},
+		{
+			name: "owner and prune",
+			config: Config{
+				OwnerID: "home-router",
+				Prune:   true,
+				Zones:   []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "www"}}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "owner with separator",
+			config: Config{
+				OwnerID: "home,router",
+				Zones:   []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "www"}}}},
+			},
+			wantErr: true,
+			errMsg:  "owner_id must not contain",
+		},
+		{
+			name: "duplicate policy",
+			config: Config{
+				DuplicatePolicy: "update_all",
+				Zones:           []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "www", Type: "HTTPS"}}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "update_all with address records",
+			config: Config{
+				DuplicatePolicy: "update_all",
+				Zones:           []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "www", Type: "HTTPS"}}}},
+				Records:         []Subdomain{{Name: "home.example.com"}},
+			},
+			wantErr: true,
+			errMsg:  "update_all cannot be used with A or AAAA records",
+		},
+		{
+			name: "unknown duplicate policy",
+			config: Config{
+				DuplicatePolicy: "keep",
+				Zones:           []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "www"}}}},
+			},
+			wantErr: true,
+			errMsg:  `unknown duplicate_policy "keep"`,
+		},
+		{
+			name: "notifiers",
+			config: Config{
+				Notifications: []Notifier{
+					{Type: "slack", URL: "https://hooks.slack.com/services/T/B/X", Events: []string{"change"}},
+					{Type: "telegram", Token: "${TELEGRAM_TOKEN}", ChatID: "42"},
+					{Type: "gotify", URL: "$GOTIFY_URL", Token: "app"},
+				},
+				Zones: []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "www"}}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "notifier without url",
+			config: Config{
+				Notifications: []Notifier{{Type: "discord"}},
+				Zones:         []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "www"}}}},
+			},
+			wantErr: true,
+			errMsg:  "notifications[0]: discord notifier requires an http(s) url",
+		},
+		{
+			name: "telegram without chat id",
+			config: Config{
+				Notifications: []Notifier{{Type: "telegram", Token: "123:abc"}},
+				Zones:         []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "www"}}}},
+			},
+			wantErr: true,
+			errMsg:  "telegram notifier requires a token and chat_id",
+		},
+		{
+			name: "unknown notifier event",
+			config: Config{
+				Notifications: []Notifier{{Type: "ntfy", URL: "https://ntfy.sh/home", Events: []string{"success"}}},
+				Zones:         []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "www"}}}},
+			},
+			wantErr: true,
+			errMsg:  `unknown event "success"`,
+		},
+		{
+			name: "email notifier",
+			config: Config{
+				Notifications: []Notifier{{
+					Type: "email", Host: "smtp.example.com", Port: 465, TLS: "tls", Username: "ddns", Password: "${SMTP_PASSWORD}",
+					From: "DDNS <ddns@example.com>", To: []string{"ops@example.com"}, FailureThreshold: 3,
+				}},
+				Zones: []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "www"}}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "email notifier without recipients",
+			config: Config{
+				Notifications: []Notifier{{Type: "email", Host: "smtp.example.com", From: "ddns@example.com"}},
+				Zones:         []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "www"}}}},
+			},
+			wantErr: true,
+			errMsg:  "email notifier requires host, from and to",
+		},
+		{
+			name: "email notifier with invalid address",
+			config: Config{
+				Notifications: []Notifier{{Type: "email", Host: "smtp.example.com", From: "ddns@example.com", To: []string{"ops"}}},
+				Zones:         []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "www"}}}},
+			},
+			wantErr: true,
+			errMsg:  `invalid address "ops"`,
+		},
+		{
+			name: "unknown email tls mode",
+			config: Config{
+				Notifications: []Notifier{{Type: "email", Host: "smtp.example.com", TLS: "ssl", From: "ddns@example.com", To: []string{"ops@example.com"}}},
+				Zones:         []Zone{{ZoneID: "zone123", Subdomains: []Subdomain{{Name: "www"}}}},
+			},
+			wantErr: true,
+			errMsg:  `unknown tls mode "ssl"`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -212,3 +686,32 @@ func TestValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	cfg := Config{
+		ConcurrencyLimit: -1,
+		Zones: []Zone{
+			{Subdomains: []Subdomain{{Name: "www", TTL: 5}, {Name: "api", Content: "nope"}}},
+			{ZoneID: "zone456"},
+		},
+		IPv4Providers: []IPProvider{{Type: "whatismyip"}},
+	}
+
+	err := Validate(&cfg)
+	if err == nil {
+		t.Fatal("Validate() expected error, got nil")
+	}
+
+	for _, want := range []string{
+		"zones[0]: missing zone_id",
+		"zones[0].subdomains[0]: TTL must be between 60 and 86400",
+		"zones[0].subdomains[1]: content must be an IP address",
+		"zones[1]: no subdomains configured",
+		"concurrency_limit must be positive",
+		`ipv4_providers[0]: unknown type "whatismyip"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() error missing %q:\n%v", want, err)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"strings"
+	"text/template"
+)
+
+type ContentData struct {
+	IPv4      string
+	IPv6      string
+	Hostname  string
+	Timestamp string
+}
+
+var sampleContentData = ContentData{
+	IPv4:      "192.0.2.1",
+	IPv6:      "2001:db8::1",
+	Hostname:  "host",
+	Timestamp: "2006-01-02T15:04:05Z",
+}
+
+func RenderContent(text string, data ContentData) (string, error) {
+	tmpl, err := template.New("content").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// validateContent renders text against sample data so unknown fields and
+// syntax errors surface when the config is loaded rather than mid-run.
+func validateContent(text string) error {
+	_, err := RenderContent(text, sampleContentData)
+	return err
+}
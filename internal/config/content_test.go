@@ -0,0 +1,31 @@
+package config
+
+import "testing"
+
+func TestRenderContent(t *testing.T) {
+	data := ContentData{IPv4: "1.2.3.4", IPv6: "2001:db8::1", Hostname: "router", Timestamp: "2025-01-02T03:04:05Z"}
+
+	tests := []struct {
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{text: "v=spf1 ip4:{{.IPv4}} ip6:{{.IPv6}} -all", want: "v=spf1 ip4:1.2.3.4 ip6:2001:db8::1 -all"},
+		{text: "{{.Hostname}} at {{.Timestamp}}", want: "router at 2025-01-02T03:04:05Z"},
+		{text: "{{if .IPv6}}has v6{{else}}v4 only{{end}}", want: "has v6"},
+		{text: "plain text", want: "plain text"},
+		{text: "{{.Nope}}", wantErr: true},
+		{text: "{{.IPv4", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := RenderContent(tt.text, data)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("RenderContent(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("RenderContent(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// unknownFields reports keys in raw that don't map to a json tag on t,
+// suggesting the closest known key for likely typos.
+func unknownFields(raw any, t reflect.Type, path string) []error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var errs []error
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := raw.(map[string]any)
+		if !ok {
+			return nil
+		}
+
+		fields := make(map[string]reflect.Type, t.NumField())
+		names := make([]string, 0, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			fields[name] = t.Field(i).Type
+			names = append(names, name)
+		}
+
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			ft, ok := fields[key]
+			if !ok {
+				msg := fmt.Sprintf("unknown field %q", key)
+				if s := suggest(key, names); s != "" {
+					msg += fmt.Sprintf(", did you mean %q?", s)
+				}
+				if path != "" {
+					msg = path + ": " + msg
+				}
+				errs = append(errs, &FieldError{Path: joinPath(path, key), Err: errors.New(msg)})
+				continue
+			}
+			errs = append(errs, unknownFields(obj[key], ft, joinPath(path, key))...)
+		}
+	case reflect.Slice:
+		// TOML arrays of tables decode as []map[string]any rather than []any.
+		list := reflect.ValueOf(raw)
+		if list.Kind() != reflect.Slice {
+			return nil
+		}
+		for i := 0; i < list.Len(); i++ {
+			errs = append(errs, unknownFields(list.Index(i).Interface(), t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+
+	return errs
+}
+
+func suggest(key string, candidates []string) string {
+	normalize := func(s string) string {
+		return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(s))
+	}
+
+	best, bestDist := "", -1
+	for _, c := range candidates {
+		if normalize(c) == normalize(key) {
+			return c
+		}
+		// Only suggest when fewer than half the characters differ.
+		d := editDistance(key, c)
+		if 2*d < max(len(key), len(c)) && (bestDist < 0 || d < bestDist) {
+			best, bestDist = c, d
+		}
+	}
+
+	return best
+}
+
+// editDistance is the Levenshtein distance with adjacent transpositions
+// counted as a single edit, so "nmae" is one edit away from "name".
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(a)][len(b)]
+}
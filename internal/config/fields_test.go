@@ -0,0 +1,76 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnknownFields(t *testing.T) {
+	raw := map[string]any{
+		"zones": []any{
+			map[string]any{
+				"zoneid": "zone123",
+				"subdomains": []any{
+					map[string]any{"name": "www", "proxy": true},
+					map[string]any{"name": "api", "Proxied": true, "xyzzy": 1},
+				},
+			},
+		},
+		"ipv4_providers": []any{map[string]any{"type": "custom", "uri": "https://example.com"}},
+		"default_ttl":    300,
+	}
+
+	errs := unknownFields(raw, reflect.TypeOf(Config{}), "")
+
+	want := []string{
+		`ipv4_providers[0]: unknown field "uri", did you mean "url"?`,
+		`zones[0].subdomains[0]: unknown field "proxy", did you mean "proxied"?`,
+		`zones[0].subdomains[1]: unknown field "Proxied", did you mean "proxied"?`,
+		`zones[0].subdomains[1]: unknown field "xyzzy"`,
+		`zones[0]: unknown field "zoneid", did you mean "zone_id"?`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors, want %d: %v", len(errs), len(want), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != want[i] {
+			t.Errorf("error %d = %q, want %q", i, err.Error(), want[i])
+		}
+	}
+
+	fe := errs[1].(*FieldError)
+	if fe.Path != "zones[0].subdomains[0].proxy" {
+		t.Errorf("Path = %q, want the unknown key's path", fe.Path)
+	}
+}
+
+func TestUnknownFieldsTopLevel(t *testing.T) {
+	errs := unknownFields(map[string]any{"zone": []any{}}, reflect.TypeOf(Config{}), "")
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), `unknown field "zone", did you mean "zones"?`) {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"name", "proxied", "ttl", "content", "ip_source"}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"nmae", "name"},
+		{"proxy", "proxied"},
+		{"TTL", "ttl"},
+		{"ip-source", "ip_source"},
+		{"ipsource", "ip_source"},
+		{"contnet", "content"},
+		{"hostname", ""},
+	}
+
+	for _, tt := range tests {
+		if got := suggest(tt.key, candidates); got != tt.want {
+			t.Errorf("suggest(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+func Load(path string) (Config, error) {
+	format, err := formatFromPath(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg, err := Parse(data, format)
+	if err == nil {
+		return cfg, nil
+	}
+
+	var lines map[string]int
+	errs := flatten(err)
+	for i, e := range errs {
+		var fe *FieldError
+		if errors.As(e, &fe) && fe.Line == 0 {
+			if lines == nil {
+				lines = fieldLines(data, format)
+			}
+			fe.Line = lookupLine(lines, fe.Path)
+		}
+		errs[i] = fmt.Errorf("%s: %w", path, e)
+	}
+	return cfg, errors.Join(errs...)
+}
+
+func Parse(data []byte, format string) (Config, error) {
+	var cfg Config
+	var raw any
+
+	switch format {
+	case "json":
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return cfg, jsonError(data, err)
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return cfg, jsonError(data, err)
+		}
+	case "yaml", "toml":
+		if format == "yaml" {
+			if err := yaml.Unmarshal(data, &raw); err != nil {
+				return cfg, err
+			}
+		} else {
+			var table map[string]any
+			if _, err := toml.Decode(string(data), &table); err != nil {
+				return cfg, err
+			}
+			raw = table
+		}
+
+		// Round-trip through JSON so every format shares the json struct tags.
+		converted, err := json.Marshal(raw)
+		if err != nil {
+			return cfg, err
+		}
+		if err := json.Unmarshal(converted, &cfg); err != nil {
+			return cfg, convertedError(converted, err)
+		}
+	default:
+		return cfg, fmt.Errorf("unsupported config format: %q", format)
+	}
+
+	errs := unknownFields(raw, reflect.TypeOf(cfg), "")
+	if err := Validate(&cfg); err != nil {
+		errs = append(errs, flatten(err)...)
+	}
+	return cfg, errors.Join(errs...)
+}
+
+func flatten(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+func formatFromPath(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json", nil
+	case ".yaml", ".yml":
+		return "yaml", nil
+	case ".toml":
+		return "toml", nil
+	default:
+		return "", fmt.Errorf("%s: unsupported config file extension, use .json, .yaml, .yml or .toml", path)
+	}
+}
+
+func jsonError(data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("line %d: %w", lineAt(data, syntaxErr.Offset), err)
+	case errors.As(err, &typeErr):
+		return fmt.Errorf("line %d: %w", lineAt(data, typeErr.Offset), err)
+	}
+	return err
+}
+
+// convertedError turns a type error from the JSON round-trip into a
+// FieldError, since its offset means nothing in the original file. Load then
+// finds the line from the field path.
+func convertedError(converted []byte, err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		return err
+	}
+	return fieldError(pathAt(converted, typeErr.Offset), "expected %s, got %s", typeErr.Type, typeErr.Value)
+}
+
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return 1 + bytes.Count(data[:offset], []byte("\n"))
+}
+
+// lookupLine walks up from path (e.g. zones[0].subdomains[1]) to the closest
+// ancestor that has a known position.
+func lookupLine(lines map[string]int, path string) int {
+	for path != "" {
+		if n, ok := lines[path]; ok {
+			return n
+		}
+		i := strings.LastIndexAny(path, ".[")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return 0
+}
+
+func fieldLines(data []byte, format string) map[string]int {
+	switch format {
+	case "json":
+		return jsonLines(data)
+	case "yaml":
+		return yamlLines(data)
+	case "toml":
+		return tomlLines(data)
+	}
+	return nil
+}
+
+func jsonLines(data []byte) map[string]int {
+	lines := make(map[string]int)
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	var walk func(path string) error
+	walk = func(path string) error {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if _, ok := lines[path]; !ok && path != "" {
+			lines[path] = lineAt(data, dec.InputOffset())
+		}
+
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				child := joinPath(path, fmt.Sprint(key))
+				lines[child] = lineAt(data, dec.InputOffset())
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				if err := walk(fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+		}
+		return err
+	}
+
+	walk("")
+	return lines
+}
+
+// pathAt returns the path of the last value read before offset, which is
+// where json reports an UnmarshalTypeError.
+func pathAt(data []byte, offset int64) string {
+	var found string
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	var walk func(path string) error
+	walk = func(path string) error {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if dec.InputOffset() <= offset {
+			found = path
+		}
+
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if err := walk(joinPath(path, fmt.Sprint(key))); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				if err := walk(fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+		}
+		return err
+	}
+
+	walk("")
+	return found
+}
+
+func yamlLines(data []byte) map[string]int {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil
+	}
+
+	lines := make(map[string]int)
+	var walk func(n *yaml.Node, path string)
+	walk = func(n *yaml.Node, path string) {
+		switch n.Kind {
+		case yaml.DocumentNode:
+			for _, c := range n.Content {
+				walk(c, path)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				child := joinPath(path, n.Content[i].Value)
+				lines[child] = n.Content[i].Line
+				walk(n.Content[i+1], child)
+			}
+		case yaml.SequenceNode:
+			for i, c := range n.Content {
+				child := fmt.Sprintf("%s[%d]", path, i)
+				lines[child] = c.Line
+				walk(c, child)
+			}
+		}
+	}
+
+	walk(&root, "")
+	return lines
+}
+
+// tomlLines indexes table headers and key/value lines. Inline tables are not
+// indexed, so errors inside them point at the enclosing key.
+func tomlLines(data []byte) map[string]int {
+	lines := make(map[string]int)
+	counts := make(map[string]int)
+
+	resolve := func(name string) string {
+		var path string
+		for _, part := range strings.Split(name, ".") {
+			path = joinPath(path, strings.Trim(strings.TrimSpace(part), `"'`))
+			if n, ok := counts[path]; ok {
+				path = fmt.Sprintf("%s[%d]", path, n-1)
+			}
+		}
+		return path
+	}
+
+	var table string
+	for i, raw := range strings.Split(string(data), "\n") {
+		line := strings.TrimSpace(raw)
+		switch {
+		case strings.HasPrefix(line, "[["):
+			name, _, _ := strings.Cut(line[2:], "]]")
+			parent, last := "", strings.TrimSpace(name)
+			if j := strings.LastIndex(last, "."); j >= 0 {
+				parent, last = resolve(last[:j]), last[j+1:]
+			}
+			base := joinPath(parent, strings.Trim(strings.TrimSpace(last), `"'`))
+			if _, ok := lines[base]; !ok {
+				lines[base] = i + 1
+			}
+			table = fmt.Sprintf("%s[%d]", base, counts[base])
+			counts[base]++
+			lines[table] = i + 1
+		case strings.HasPrefix(line, "["):
+			name, _, _ := strings.Cut(line[1:], "]")
+			table = resolve(name)
+			lines[table] = i + 1
+		default:
+			key, _, ok := strings.Cut(line, "=")
+			key = strings.Trim(strings.TrimSpace(key), `"'`)
+			if !ok || key == "" || strings.ContainsAny(key, "#{}[] ") {
+				continue
+			}
+			lines[joinPath(table, key)] = i + 1
+		}
+	}
+
+	return lines
+}
+
+func joinPath(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
@@ -0,0 +1,328 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{
+			name: "json",
+			file: "config.json",
+			content: `{
+  "default_ttl": 600,
+  "zones": [
+    {"zone_id": "zone123", "subdomains": [{"name": "www", "proxied": true}, {"name": "nas", "content": "192.168.1.20"}]}
+  ]
+}`,
+		},
+		{
+			name: "yaml",
+			file: "config.yaml",
+			content: `default_ttl: 600
+zones:
+  - zone_id: zone123
+    subdomains:
+      - name: www
+        proxied: true
+      - name: nas
+        content: 192.168.1.20
+`,
+		},
+		{
+			name: "yml extension",
+			file: "config.yml",
+			content: `default_ttl: 600
+zones:
+  - {zone_id: zone123, subdomains: [{name: www, proxied: true}, {name: nas, content: 192.168.1.20}]}
+`,
+		},
+		{
+			name: "toml",
+			file: "config.toml",
+			content: `default_ttl = 600
+
+[[zones]]
+zone_id = "zone123"
+
+[[zones.subdomains]]
+name = "www"
+proxied = true
+
+[[zones.subdomains]]
+name = "nas"
+content = "192.168.1.20"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(writeConfig(t, tt.file, tt.content))
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			if cfg.DefaultTTL != 600 {
+				t.Errorf("DefaultTTL = %d, want 600", cfg.DefaultTTL)
+			}
+			if len(cfg.Zones) != 1 || cfg.Zones[0].ZoneID != "zone123" {
+				t.Fatalf("unexpected zones: %+v", cfg.Zones)
+			}
+			subs := cfg.Zones[0].Subdomains
+			if len(subs) != 2 || subs[0].Name != "www" || !subs[0].Proxied || subs[1].Content != "192.168.1.20" {
+				t.Errorf("unexpected subdomains: %+v", subs)
+			}
+		})
+	}
+}
+
+func TestLoadErrorLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		errMsg  string
+	}{
+		{
+			name: "json validation error",
+			file: "config.json",
+			content: `{
+  "zones": [
+    {
+      "zone_id": "zone123",
+      "subdomains": [
+        {"name": "www"},
+        {"name": "api", "ttl": 5}
+      ]
+    }
+  ]
+}`,
+			errMsg: "line 7: zones[0].subdomains[1]: TTL must be between 60 and 86400",
+		},
+		{
+			name: "json syntax error",
+			file: "config.json",
+			content: `{
+  "zones": [
+    {"zone_id": "zone123",}
+  ]
+}`,
+			errMsg: "line 3:",
+		},
+		{
+			name: "yaml validation error",
+			file: "config.yaml",
+			content: `zones:
+  - zone_id: zone123
+    subdomains:
+      - name: www
+        content: not-an-ip
+`,
+			errMsg: "line 4: zones[0].subdomains[0]: content must be an IP address",
+		},
+		{
+			name: "yaml top-level field",
+			file: "config.yaml",
+			content: `zones:
+  - zone_id: zone123
+    subdomains: [{name: www}]
+concurrency_limit: -1
+`,
+			errMsg: "line 4: concurrency_limit must be positive",
+		},
+		{
+			name: "yaml type error",
+			file: "config.yaml",
+			content: `zones:
+  - zone_id: zone123
+    subdomains:
+      - name: www
+      - name: api
+        ttl: abc
+`,
+			errMsg: "line 6: zones[0].subdomains[1].ttl: expected int, got string",
+		},
+		{
+			name: "toml validation error",
+			file: "config.toml",
+			content: `[[zones]]
+zone_id = "zone123"
+
+[[zones.subdomains]]
+name = "www"
+
+[[zones]]
+zone_id = "zone456"
+
+[[zones.subdomains]]
+name = "api"
+ip_source = "vpn"
+`,
+			errMsg: `line 10: zones[1].subdomains[0]: unknown ip_source "vpn"`,
+		},
+		{
+			name: "toml provider error",
+			file: "config.toml",
+			content: `ipv4_providers = [{type = "ipify"}, {type = "nope"}]
+
+[[zones]]
+zone_id = "zone123"
+subdomains = [{name = "www"}]
+`,
+			errMsg: `line 1: ipv4_providers[1]: unknown type "nope"`,
+		},
+		{
+			name: "toml type error",
+			file: "config.toml",
+			content: `concurrency_limit = 4
+
+[[zones]]
+zone_id = "zone123"
+
+[[zones.subdomains]]
+name = "www"
+proxied = "yes"
+`,
+			errMsg: "line 8: zones[0].subdomains[0].proxied: expected bool, got string",
+		},
+		{
+			name:    "toml syntax error",
+			file:    "config.toml",
+			content: "[[zones]]\nzone_id = \n",
+			errMsg:  "line 2",
+		},
+		{
+			name:    "unsupported extension",
+			file:    "config.ini",
+			content: "",
+			errMsg:  "unsupported config file extension",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, tt.file, tt.content)
+			_, err := Load(path)
+			if err == nil {
+				t.Fatal("Load() expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("Load() error = %q, want it to contain %q", err.Error(), tt.errMsg)
+			}
+			if !strings.HasPrefix(err.Error(), path) {
+				t.Errorf("Load() error = %q, want it to start with the file path", err.Error())
+			}
+		})
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	cfg, err := Parse([]byte(`{"zones":[{"zone_id":"zone123","subdomains":[{"name":"www"}]}]}`), "json")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if cfg.Zones[0].Subdomains[0].Name != "www" {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+
+	if _, err := Parse([]byte(`{"zones":[]}`), "json"); err == nil || !strings.Contains(err.Error(), "no zones or records configured") {
+		t.Errorf("Parse() error = %v, want validation error", err)
+	}
+}
+
+func TestLoadReportsAllProblems(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []string
+	}{
+		{
+			name: "yaml",
+			file: "config.yaml",
+			content: `zones:
+  - zoneid: zone123
+    subdomains:
+      - name: www
+        proxy: true
+      - name: api
+        ttl: 5
+concurrency_limit: -1
+`,
+			want: []string{
+				`line 2: zones[0]: unknown field "zoneid", did you mean "zone_id"?`,
+				`line 5: zones[0].subdomains[0]: unknown field "proxy", did you mean "proxied"?`,
+				"line 2: zones[0]: missing zone_id",
+				"line 6: zones[0].subdomains[1]: TTL must be between 60 and 86400",
+				"line 8: concurrency_limit must be positive",
+			},
+		},
+		{
+			name: "json",
+			file: "config.json",
+			content: `{
+  "zones": [
+    {
+      "zone_id": "zone123",
+      "subdomains": [{"name": "www", "proxy": true}]
+    }
+  ],
+  "defualt_ttl": 300
+}`,
+			want: []string{
+				`line 8: unknown field "defualt_ttl", did you mean "default_ttl"?`,
+				`line 5: zones[0].subdomains[0]: unknown field "proxy", did you mean "proxied"?`,
+			},
+		},
+		{
+			name: "toml",
+			file: "config.toml",
+			content: `[[zones]]
+zone_id = "zone123"
+
+[[zones.subdomains]]
+name = "www"
+proxid = true
+`,
+			want: []string{
+				`line 6: zones[0].subdomains[0]: unknown field "proxid", did you mean "proxied"?`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, tt.file, tt.content))
+			if err == nil {
+				t.Fatal("Load() expected error, got nil")
+			}
+
+			problems := strings.Split(err.Error(), "\n")
+			if len(problems) != len(tt.want) {
+				t.Fatalf("got %d problems, want %d:\n%v", len(problems), len(tt.want), err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Load() error missing %q:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/oberwager/cloudflare-ddns/internal/cloudflare"
+)
+
+// Tracker records the daemon's progress for the /healthz and /readyz probes.
+type Tracker struct {
+	interval       time.Duration
+	readyIntervals int
+	now            func() time.Time
+
+	mu          sync.Mutex
+	started     time.Time
+	runStarted  time.Time
+	running     bool
+	lastRun     time.Time
+	lastSuccess time.Time
+	lastErr     error
+	tokenErr    error
+	ips         cloudflare.DetectedIPs
+	zones       []ZoneStatus
+}
+
+type ZoneStatus struct {
+	ZoneID    string `json:"zone_id"`
+	Domain    string `json:"domain,omitempty"`
+	Status    string `json:"status"`
+	Created   int    `json:"created"`
+	Updated   int    `json:"updated"`
+	Unchanged int    `json:"unchanged"`
+	Deleted   int    `json:"deleted"`
+	Failed    int    `json:"failed"`
+	Error     string `json:"error,omitempty"`
+}
+
+type Status struct {
+	Status      string       `json:"status"`
+	Reason      string       `json:"reason,omitempty"`
+	StartedAt   time.Time    `json:"started_at"`
+	LastRunAt   *time.Time   `json:"last_run_at,omitempty"`
+	LastSuccess *time.Time   `json:"last_success_at,omitempty"`
+	LastError   string       `json:"last_error,omitempty"`
+	TokenError  string       `json:"token_error,omitempty"`
+	IPv4        string       `json:"ipv4,omitempty"`
+	IPv6        string       `json:"ipv6,omitempty"`
+	Zones       []ZoneStatus `json:"zones"`
+}
+
+func NewTracker(interval time.Duration, readyIntervals int) *Tracker {
+	t := &Tracker{interval: interval, readyIntervals: readyIntervals, now: time.Now}
+	t.started = t.now()
+	return t
+}
+
+func (t *Tracker) RunStarted() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.running, t.runStarted = true, t.now()
+}
+
+// RunFinished records the outcome of a scheduled run. A nil error counts as a
+// successful reconciliation, including runs skipped because the IP is unchanged.
+func (t *Tracker) RunFinished(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.running, t.lastRun, t.lastErr = false, t.now(), err
+	if err == nil {
+		t.lastSuccess = t.lastRun
+	}
+}
+
+func (t *Tracker) SetIPs(ips cloudflare.DetectedIPs) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ips = ips
+}
+
+func (t *Tracker) SetSummary(summary cloudflare.RunSummary) {
+	zones := make([]ZoneStatus, 0, len(summary.Zones))
+	for i := range summary.Zones {
+		z := &summary.Zones[i]
+		zs := ZoneStatus{
+			ZoneID:    z.ZoneID,
+			Domain:    z.Domain,
+			Status:    "ok",
+			Created:   z.Count(cloudflare.Created),
+			Updated:   z.Count(cloudflare.Updated),
+			Unchanged: z.Count(cloudflare.Unchanged),
+			Deleted:   z.Count(cloudflare.Deleted),
+			Failed:    z.Count(cloudflare.Failed),
+		}
+		if z.Err != nil {
+			zs.Status, zs.Error = "failed", z.Err.Error()
+		} else if zs.Failed > 0 {
+			zs.Status = "partial_failure"
+		}
+		zones = append(zones, zs)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.zones = zones
+}
+
+// SetTokenError records the result of the latest token check. Only a rejected
+// or inactive token counts; timeouts, rate limits and server errors say
+// nothing about the token and are ignored.
+func (t *Tracker) SetTokenError(err error) {
+	var apiErr *cloudflare.APIError
+	rejected := errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden)
+	if err != nil && !rejected && !errors.Is(err, cloudflare.ErrTokenInactive) {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tokenErr = err
+}
+
+// Live fails when the scheduler loop appears stuck: a run has been going for
+// several intervals, or none has finished for as long.
+func (t *Tracker) Live() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	limit := 3 * t.interval
+	now := t.now()
+	if t.running {
+		if d := now.Sub(t.runStarted); d > limit {
+			return fmt.Errorf("run in progress for %s", d.Round(time.Second))
+		}
+		return nil
+	}
+
+	last := t.lastRun
+	if last.IsZero() {
+		last = t.started
+	}
+	if d := now.Sub(last); d > limit {
+		return fmt.Errorf("no run finished for %s", d.Round(time.Second))
+	}
+	return nil
+}
+
+// Ready fails until a run succeeds, when the last success is older than the
+// configured number of intervals, or when the API token was rejected.
+func (t *Tracker) Ready() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.tokenErr != nil {
+		return fmt.Errorf("api token invalid: %w", t.tokenErr)
+	}
+	if t.lastSuccess.IsZero() {
+		return errors.New("no successful run yet")
+	}
+	if d := t.now().Sub(t.lastSuccess); d > time.Duration(t.readyIntervals)*t.interval {
+		return fmt.Errorf("last successful run was %s ago", d.Round(time.Second))
+	}
+	return nil
+}
+
+func (t *Tracker) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := Status{
+		Status:    "ok",
+		StartedAt: t.started,
+		IPv4:      t.ips.IPv4,
+		IPv6:      t.ips.IPv6,
+		Zones:     t.zones,
+	}
+	if !t.lastRun.IsZero() {
+		lastRun := t.lastRun
+		s.LastRunAt = &lastRun
+	}
+	if !t.lastSuccess.IsZero() {
+		lastSuccess := t.lastSuccess
+		s.LastSuccess = &lastSuccess
+	}
+	if t.lastErr != nil {
+		s.LastError = t.lastErr.Error()
+	}
+	if t.tokenErr != nil {
+		s.TokenError = t.tokenErr.Error()
+	}
+	if s.Zones == nil {
+		s.Zones = []ZoneStatus{}
+	}
+	return s
+}
+
+func (t *Tracker) LiveHandler() http.Handler  { return t.handler(t.Live) }
+func (t *Tracker) ReadyHandler() http.Handler { return t.handler(t.Ready) }
+
+func (t *Tracker) handler(check func() error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := t.Status()
+		code := http.StatusOK
+		if err := check(); err != nil {
+			status.Status, status.Reason = "unavailable", err.Error()
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(status)
+	})
+}
@@ -0,0 +1,154 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oberwager/cloudflare-ddns/internal/cloudflare"
+)
+
+func newTestTracker(interval time.Duration, readyIntervals int) (*Tracker, *time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	t := NewTracker(interval, readyIntervals)
+	t.now = func() time.Time { return now }
+	t.started = now
+	return t, &now
+}
+
+func TestLive(t *testing.T) {
+	tracker, now := newTestTracker(time.Minute, 3)
+
+	if err := tracker.Live(); err != nil {
+		t.Errorf("expected live after start, got %v", err)
+	}
+
+	tracker.RunStarted()
+	*now = now.Add(2 * time.Minute)
+	if err := tracker.Live(); err != nil {
+		t.Errorf("expected live during a short run, got %v", err)
+	}
+
+	*now = now.Add(2 * time.Minute)
+	if err := tracker.Live(); err == nil || !strings.Contains(err.Error(), "run in progress for 4m0s") {
+		t.Errorf("expected stuck run error, got %v", err)
+	}
+
+	tracker.RunFinished(errors.New("boom"))
+	if err := tracker.Live(); err != nil {
+		t.Errorf("a failed run should still count as live, got %v", err)
+	}
+
+	*now = now.Add(4 * time.Minute)
+	if err := tracker.Live(); err == nil || !strings.Contains(err.Error(), "no run finished") {
+		t.Errorf("expected stalled loop error, got %v", err)
+	}
+}
+
+func TestReady(t *testing.T) {
+	tracker, now := newTestTracker(time.Minute, 3)
+
+	if err := tracker.Ready(); err == nil || !strings.Contains(err.Error(), "no successful run yet") {
+		t.Errorf("expected not ready before first run, got %v", err)
+	}
+
+	tracker.RunStarted()
+	tracker.RunFinished(nil)
+	if err := tracker.Ready(); err != nil {
+		t.Errorf("expected ready after a successful run, got %v", err)
+	}
+
+	*now = now.Add(2 * time.Minute)
+	tracker.RunStarted()
+	tracker.RunFinished(errors.New("boom"))
+	if err := tracker.Ready(); err != nil {
+		t.Errorf("expected ready within 3 intervals of success, got %v", err)
+	}
+
+	*now = now.Add(2 * time.Minute)
+	if err := tracker.Ready(); err == nil || !strings.Contains(err.Error(), "last successful run was 4m0s ago") {
+		t.Errorf("expected stale success error, got %v", err)
+	}
+}
+
+func TestReadyTokenError(t *testing.T) {
+	tracker, _ := newTestTracker(time.Minute, 3)
+	tracker.RunFinished(nil)
+
+	tracker.SetTokenError(context.DeadlineExceeded)
+	if err := tracker.Ready(); err != nil {
+		t.Errorf("network errors should not mark the token invalid, got %v", err)
+	}
+
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusBadGateway} {
+		tracker.SetTokenError(fmt.Errorf("verify token: %w", &cloudflare.APIError{StatusCode: status}))
+		if err := tracker.Ready(); err != nil {
+			t.Errorf("HTTP %d should not mark the token invalid, got %v", status, err)
+		}
+	}
+
+	tracker.SetTokenError(fmt.Errorf("verify token: %w", &cloudflare.APIError{StatusCode: 401, Message: "Invalid API Token"}))
+	if err := tracker.Ready(); err == nil || !strings.Contains(err.Error(), "api token invalid") {
+		t.Errorf("expected token error, got %v", err)
+	}
+
+	tracker.SetTokenError(nil)
+	if err := tracker.Ready(); err != nil {
+		t.Errorf("expected ready after the token verified again, got %v", err)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	tracker, _ := newTestTracker(time.Minute, 3)
+	tracker.SetIPs(cloudflare.DetectedIPs{IPv4: "1.2.3.4"})
+	tracker.SetSummary(cloudflare.RunSummary{Zones: []cloudflare.ZoneSummary{
+		{ZoneID: "zone123", Domain: "example.com", Records: []cloudflare.RecordResult{
+			{FQDN: "www.example.com", Type: "A", Outcome: cloudflare.Updated},
+			{FQDN: "api.example.com", Type: "A", Outcome: cloudflare.Failed, Err: errors.New("quota")},
+		}},
+		{ZoneID: "zone456", Err: errors.New("get zone: forbidden")},
+	}})
+
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		wantCode int
+	}{
+		{"healthz", tracker.LiveHandler(), http.StatusOK},
+		{"readyz", tracker.ReadyHandler(), http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, httptest.NewRequest("GET", "/"+tt.name, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+
+			var status Status
+			if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if status.IPv4 != "1.2.3.4" || len(status.Zones) != 2 {
+				t.Fatalf("unexpected status: %+v", status)
+			}
+			if z := status.Zones[0]; z.Status != "partial_failure" || z.Updated != 1 || z.Failed != 1 {
+				t.Errorf("unexpected zone status: %+v", z)
+			}
+			if z := status.Zones[1]; z.Status != "failed" || z.Error != "get zone: forbidden" {
+				t.Errorf("unexpected zone status: %+v", z)
+			}
+			if tt.wantCode != http.StatusOK && status.Reason == "" {
+				t.Errorf("expected a reason when unavailable")
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package ip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/oberwager/cloudflare-ddns/internal/metrics"
+	"github.com/oberwager/cloudflare-ddns/internal/retry"
+	"github.com/oberwager/cloudflare-ddns/internal/tracing"
+)
+
+var chainRetryConfig = retry.Config{
+	MaxRetries:  2,
+	InitialWait: 1 * time.Second,
+	MaxWait:     4 * time.Second,
+	OnRetry:     countRetry,
+}
+
+func countRetry() { metrics.RetryAttempts.Inc() }
+
+type Chain struct {
+	providers []Provider
+}
+
+func NewChain(providers ...Provider) *Chain {
+	return &Chain{providers: providers}
+}
+
+func (c *Chain) Name() string {
+	return "chain"
+}
+
+func (c *Chain) GetIP(ctx context.Context, isIPv6 bool) (string, error) {
+	if len(c.providers) == 0 {
+		return "", fmt.Errorf("no ip providers configured")
+	}
+
+	// A lone provider has nothing to fall back to, so give it the full retry budget.
+	config := chainRetryConfig
+	if len(c.providers) == 1 {
+		config = retry.DefaultConfig()
+		config.OnRetry = countRetry
+	}
+
+	ipType := familyName(isIPv6)
+	var errs []error
+
+	for _, p := range c.providers {
+		ctx, span := tracing.StartClient(ctx, "ip provider", tracing.String("provider", p.Name()), tracing.String("ip.family", ipType))
+		var result string
+		err := retry.WithBackoff(ctx, fmt.Sprintf("get %s from %s", ipType, p.Name()), config, func() error {
+			ip, err := p.GetIP(ctx, isIPv6)
+			if err != nil {
+				return err
+			}
+
+			if err := validateIP(ip, isIPv6); err != nil {
+				return fmt.Errorf("validation failed: %w", err)
+			}
+
+			result = ip
+			return nil
+		})
+		span.SetAttributes(tracing.String("ip", result))
+		span.End(err)
+		if err == nil {
+			return result, nil
+		}
+
+		if ctx.Err() != nil {
+			return "", err
+		}
+
+		slog.WarnContext(ctx, "ip provider failed, trying next", "provider", p.Name(), "type", ipType, "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+	}
+
+	return "", fmt.Errorf("all %s providers failed: %w", ipType, errors.Join(errs...))
+}
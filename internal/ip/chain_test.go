@@ -0,0 +1,92 @@
+package ip
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/oberwager/cloudflare-ddns/internal/retry"
+)
+
+type stubProvider struct {
+	name  string
+	ip    string
+	err   error
+	calls int
+}
+
+func (s *stubProvider) Name() string { return s.name }
+
+func (s *stubProvider) GetIP(ctx context.Context, isIPv6 bool) (string, error) {
+	s.calls++
+	return s.ip, s.err
+}
+
+func useFastChainRetries(t *testing.T) {
+	t.Helper()
+	original := chainRetryConfig
+	chainRetryConfig = retry.Config{
+		MaxRetries:  1,
+		InitialWait: 1 * time.Millisecond,
+		MaxWait:     1 * time.Millisecond,
+	}
+	t.Cleanup(func() { chainRetryConfig = original })
+}
+
+func TestChainFirstProviderSucceeds(t *testing.T) {
+	useFastChainRetries(t)
+
+	first := &stubProvider{name: "first", ip: "198.51.100.1"}
+	second := &stubProvider{name: "second", ip: "198.51.100.2"}
+
+	ip, err := NewChain(first, second).GetIP(context.Background(), false)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if ip != "198.51.100.1" {
+		t.Errorf("expected 198.51.100.1, got %s", ip)
+	}
+	if second.calls != 0 {
+		t.Errorf("expected second provider not to be called, got %d calls", second.calls)
+	}
+}
+
+func TestChainFallsBack(t *testing.T) {
+	useFastChainRetries(t)
+
+	down := &stubProvider{name: "down", err: errors.New("connection refused")}
+	wrongFamily := &stubProvider{name: "wrong-family", ip: "2001:db8::1"}
+	up := &stubProvider{name: "up", ip: "198.51.100.2"}
+
+	ip, err := NewChain(down, wrongFamily, up).GetIP(context.Background(), false)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if ip != "198.51.100.2" {
+		t.Errorf("expected 198.51.100.2, got %s", ip)
+	}
+	if down.calls != 2 {
+		t.Errorf("expected retryable failure to be retried once, got %d calls", down.calls)
+	}
+	if wrongFamily.calls != 1 {
+		t.Errorf("expected validation failure not to be retried, got %d calls", wrongFamily.calls)
+	}
+}
+
+func TestChainAllFail(t *testing.T) {
+	useFastChainRetries(t)
+
+	chain := NewChain(
+		&stubProvider{name: "a", err: errors.New("unexpected status: 503")},
+		&stubProvider{name: "b", ip: "not-an-ip"},
+	)
+
+	if _, err := chain.GetIP(context.Background(), false); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	if _, err := NewChain().GetIP(context.Background(), false); err == nil {
+		t.Fatal("expected error for empty chain, got nil")
+	}
+}
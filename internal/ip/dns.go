@@ -0,0 +1,247 @@
+package ip
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	dnsTypeA    = 1
+	dnsTypeTXT  = 16
+	dnsTypeAAAA = 28
+
+	dnsClassIN    = 1
+	dnsClassCHAOS = 3
+
+	dnsTimeout = 5 * time.Second
+)
+
+type dnsProvider struct {
+	name       string
+	ipv4Server string
+	ipv6Server string
+	server     string
+	qname      string
+	qtype      uint16
+	qclass     uint16
+}
+
+func newDNSProvider(resolver, server string) (*dnsProvider, error) {
+	var p *dnsProvider
+	switch resolver {
+	case "", "opendns":
+		p = &dnsProvider{
+			name:       "dns:opendns",
+			ipv4Server: "208.67.222.222:53",
+			ipv6Server: "[2620:119:35::35]:53",
+			qname:      "myip.opendns.com",
+			qclass:     dnsClassIN,
+		}
+	case "cloudflare":
+		p = &dnsProvider{
+			name:       "dns:cloudflare",
+			ipv4Server: "1.1.1.1:53",
+			ipv6Server: "[2606:4700:4700::1111]:53",
+			qname:      "whoami.cloudflare",
+			qtype:      dnsTypeTXT,
+			qclass:     dnsClassCHAOS,
+		}
+	default:
+		return nil, fmt.Errorf("unknown dns resolver: %q", resolver)
+	}
+
+	p.server = server
+	return p, nil
+}
+
+func (p *dnsProvider) Name() string {
+	return p.name
+}
+
+func (p *dnsProvider) GetIP(ctx context.Context, isIPv6 bool) (string, error) {
+	network, server := "udp4", p.ipv4Server
+	if isIPv6 {
+		network, server = "udp6", p.ipv6Server
+	}
+	if p.server != "" {
+		network, server = "udp", p.server
+	}
+
+	qtype := p.qtype
+	if qtype == 0 {
+		qtype = dnsTypeA
+		if isIPv6 {
+			qtype = dnsTypeAAAA
+		}
+	}
+
+	id := uint16(rand.Intn(1 << 16))
+	query, err := buildDNSQuery(id, p.qname, qtype, p.qclass)
+	if err != nil {
+		return "", err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return "", fmt.Errorf("dial %s: %w", server, err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(deadlineFor(ctx, dnsTimeout))
+
+	if _, err := conn.Write(query); err != nil {
+		return "", fmt.Errorf("send query: %w", err)
+	}
+
+	buf := make([]byte, 1232)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+
+	answers, err := parseDNSResponse(buf[:n], id, qtype)
+	if err != nil {
+		return "", err
+	}
+	if len(answers) == 0 {
+		return "", fmt.Errorf("no answer for %s from %s", p.qname, server)
+	}
+
+	return answers[0], nil
+}
+
+func buildDNSQuery(id uint16, name string, qtype, qclass uint16) ([]byte, error) {
+	msg := make([]byte, 12, 64)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], 0x0100) // recursion desired
+	binary.BigEndian.PutUint16(msg[4:], 1)
+
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("invalid dns name: %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, qclass)
+
+	return msg, nil
+}
+
+var errShortDNSMessage = errors.New("dns message too short")
+
+func parseDNSResponse(msg []byte, id, qtype uint16) ([]string, error) {
+	if len(msg) < 12 {
+		return nil, errShortDNSMessage
+	}
+
+	if got := binary.BigEndian.Uint16(msg[0:]); got != id {
+		return nil, fmt.Errorf("dns response id mismatch: got %d, want %d", got, id)
+	}
+
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&0x8000 == 0 {
+		return nil, fmt.Errorf("dns message is not a response")
+	}
+	if flags&0x0200 != 0 {
+		return nil, fmt.Errorf("dns response truncated")
+	}
+	if rcode := flags & 0x000f; rcode != 0 {
+		return nil, fmt.Errorf("dns response code %d", rcode)
+	}
+
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:]))
+	off := 12
+
+	for i := 0; i < qdcount; i++ {
+		var err error
+		if off, err = skipDNSName(msg, off); err != nil {
+			return nil, err
+		}
+		off += 4
+	}
+
+	var answers []string
+	for i := 0; i < ancount; i++ {
+		var err error
+		if off, err = skipDNSName(msg, off); err != nil {
+			return nil, err
+		}
+		if off+10 > len(msg) {
+			return nil, errShortDNSMessage
+		}
+
+		rtype := binary.BigEndian.Uint16(msg[off:])
+		rdlength := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdlength > len(msg) {
+			return nil, errShortDNSMessage
+		}
+		rdata := msg[off : off+rdlength]
+		off += rdlength
+
+		if rtype != qtype {
+			continue
+		}
+
+		switch rtype {
+		case dnsTypeA, dnsTypeAAAA:
+			if len(rdata) != net.IPv4len && len(rdata) != net.IPv6len {
+				return nil, fmt.Errorf("invalid address length %d", len(rdata))
+			}
+			answers = append(answers, net.IP(rdata).String())
+		case dnsTypeTXT:
+			txt, err := parseTXT(rdata)
+			if err != nil {
+				return nil, err
+			}
+			answers = append(answers, txt)
+		}
+	}
+
+	return answers, nil
+}
+
+func skipDNSName(msg []byte, off int) (int, error) {
+	for {
+		if off >= len(msg) {
+			return 0, errShortDNSMessage
+		}
+
+		length := int(msg[off])
+		switch {
+		case length == 0:
+			return off + 1, nil
+		case length&0xc0 == 0xc0:
+			if off+2 > len(msg) {
+				return 0, errShortDNSMessage
+			}
+			return off + 2, nil
+		default:
+			off += 1 + length
+		}
+	}
+}
+
+func parseTXT(rdata []byte) (string, error) {
+	var b strings.Builder
+	for len(rdata) > 0 {
+		length := int(rdata[0])
+		if 1+length > len(rdata) {
+			return "", errShortDNSMessage
+		}
+		b.Write(rdata[1 : 1+length])
+		rdata = rdata[1+length:]
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,195 @@
+package ip
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+type dnsAnswer struct {
+	rtype uint16
+	rdata []byte
+}
+
+// startDNSServer answers every query by echoing the question and appending
+// the given answers, each named by a compression pointer to the question.
+func startDNSServer(t *testing.T, rcode uint16, answers ...dnsAnswer) (string, chan []byte) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	queries := make(chan []byte, 10)
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			query := append([]byte(nil), buf[:n]...)
+			queries <- query
+
+			resp := append([]byte(nil), query...)
+			binary.BigEndian.PutUint16(resp[2:], 0x8180|rcode)
+			binary.BigEndian.PutUint16(resp[6:], uint16(len(answers)))
+			for _, a := range answers {
+				resp = append(resp, 0xc0, 0x0c)
+				resp = binary.BigEndian.AppendUint16(resp, a.rtype)
+				resp = binary.BigEndian.AppendUint16(resp, binary.BigEndian.Uint16(query[len(query)-2:]))
+				resp = binary.BigEndian.AppendUint32(resp, 0)
+				resp = binary.BigEndian.AppendUint16(resp, uint16(len(a.rdata)))
+				resp = append(resp, a.rdata...)
+			}
+			conn.WriteTo(resp, addr)
+		}
+	}()
+
+	return conn.LocalAddr().String(), queries
+}
+
+func txtRData(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+func TestDNSProviderOpenDNS(t *testing.T) {
+	server, queries := startDNSServer(t, 0,
+		dnsAnswer{rtype: dnsTypeA, rdata: net.ParseIP("203.0.113.9").To4()},
+	)
+
+	p, err := newDNSProvider("opendns", server)
+	if err != nil {
+		t.Fatalf("newDNSProvider() error = %v", err)
+	}
+
+	ip, err := p.GetIP(context.Background(), false)
+	if err != nil {
+		t.Fatalf("GetIP() error = %v", err)
+	}
+	if ip != "203.0.113.9" {
+		t.Errorf("GetIP() = %q, want 203.0.113.9", ip)
+	}
+
+	query := <-queries
+	if qtype := binary.BigEndian.Uint16(query[len(query)-4:]); qtype != dnsTypeA {
+		t.Errorf("expected A query, got type %d", qtype)
+	}
+	if qclass := binary.BigEndian.Uint16(query[len(query)-2:]); qclass != dnsClassIN {
+		t.Errorf("expected IN class, got %d", qclass)
+	}
+}
+
+func TestDNSProviderOpenDNSIPv6(t *testing.T) {
+	server, queries := startDNSServer(t, 0,
+		dnsAnswer{rtype: dnsTypeAAAA, rdata: net.ParseIP("2001:db8::9")},
+	)
+
+	p, _ := newDNSProvider("opendns", server)
+	ip, err := p.GetIP(context.Background(), true)
+	if err != nil {
+		t.Fatalf("GetIP() error = %v", err)
+	}
+	if ip != "2001:db8::9" {
+		t.Errorf("GetIP() = %q, want 2001:db8::9", ip)
+	}
+
+	query := <-queries
+	if qtype := binary.BigEndian.Uint16(query[len(query)-4:]); qtype != dnsTypeAAAA {
+		t.Errorf("expected AAAA query, got type %d", qtype)
+	}
+}
+
+func TestDNSProviderCloudflareWhoami(t *testing.T) {
+	server, queries := startDNSServer(t, 0,
+		dnsAnswer{rtype: dnsTypeTXT, rdata: txtRData("198.51.100.23")},
+	)
+
+	p, _ := newDNSProvider("cloudflare", server)
+	ip, err := p.GetIP(context.Background(), false)
+	if err != nil {
+		t.Fatalf("GetIP() error = %v", err)
+	}
+	if ip != "198.51.100.23" {
+		t.Errorf("GetIP() = %q, want 198.51.100.23", ip)
+	}
+
+	query := <-queries
+	if qtype := binary.BigEndian.Uint16(query[len(query)-4:]); qtype != dnsTypeTXT {
+		t.Errorf("expected TXT query, got type %d", qtype)
+	}
+	if qclass := binary.BigEndian.Uint16(query[len(query)-2:]); qclass != dnsClassCHAOS {
+		t.Errorf("expected CH class, got %d", qclass)
+	}
+}
+
+func TestDNSProviderErrors(t *testing.T) {
+	t.Run("nxdomain", func(t *testing.T) {
+		server, _ := startDNSServer(t, 3)
+		p, _ := newDNSProvider("opendns", server)
+		if _, err := p.GetIP(context.Background(), false); err == nil {
+			t.Error("expected error for NXDOMAIN, got nil")
+		}
+	})
+
+	t.Run("no answers", func(t *testing.T) {
+		server, _ := startDNSServer(t, 0)
+		p, _ := newDNSProvider("opendns", server)
+		if _, err := p.GetIP(context.Background(), false); err == nil {
+			t.Error("expected error for empty answer, got nil")
+		}
+	})
+
+	t.Run("unknown resolver", func(t *testing.T) {
+		if _, err := newDNSProvider("google", ""); err == nil {
+			t.Error("expected error for unknown resolver, got nil")
+		}
+	})
+}
+
+func TestBuildDNSQuery(t *testing.T) {
+	msg, err := buildDNSQuery(0x1234, "myip.opendns.com", dnsTypeA, dnsClassIN)
+	if err != nil {
+		t.Fatalf("buildDNSQuery() error = %v", err)
+	}
+
+	want := []byte{
+		0x12, 0x34, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		4, 'm', 'y', 'i', 'p', 7, 'o', 'p', 'e', 'n', 'd', 'n', 's', 3, 'c', 'o', 'm', 0,
+		0x00, 0x01, 0x00, 0x01,
+	}
+	if string(msg) != string(want) {
+		t.Errorf("buildDNSQuery() = %x, want %x", msg, want)
+	}
+
+	if _, err := buildDNSQuery(1, "bad..name", dnsTypeA, dnsClassIN); err == nil {
+		t.Error("expected error for empty label, got nil")
+	}
+}
+
+func TestParseDNSResponseMalformed(t *testing.T) {
+	query, _ := buildDNSQuery(7, "whoami.cloudflare", dnsTypeTXT, dnsClassCHAOS)
+
+	tests := []struct {
+		name string
+		msg  []byte
+		id   uint16
+	}{
+		{"too short", []byte{0, 7, 0x81}, 7},
+		{"id mismatch", append([]byte{0, 8, 0x81, 0x80}, query[4:]...), 7},
+		{"not a response", query, 7},
+		{"truncated flag", append([]byte{0, 7, 0x83, 0x80}, query[4:]...), 7},
+		{"answer past end", append(append([]byte{0, 7, 0x81, 0x80, 0, 1, 0, 1}, query[8:]...), 0xc0, 0x0c, 0, 16), 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseDNSResponse(tt.msg, tt.id, dnsTypeTXT); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,357 @@
+package ip
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oberwager/cloudflare-ddns/internal/retry"
+)
+
+const (
+	natpmpPort     = 5351
+	gatewayTimeout = 3 * time.Second
+	ssdpAddr       = "239.255.255.250:1900"
+)
+
+var igdServiceTypes = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+type gatewayProvider struct {
+	protocol       string
+	gateway        string
+	descriptionURL string
+	natpmpPort     int
+	ssdpAddr       string
+	defaultGateway func() (net.IP, error)
+}
+
+func newGatewayProvider(protocol, gateway, descriptionURL string) (*gatewayProvider, error) {
+	switch protocol {
+	case "", "natpmp", "upnp":
+	default:
+		return nil, fmt.Errorf("unknown gateway protocol: %q", protocol)
+	}
+
+	return &gatewayProvider{
+		protocol:       protocol,
+		gateway:        gateway,
+		descriptionURL: descriptionURL,
+		natpmpPort:     natpmpPort,
+		ssdpAddr:       ssdpAddr,
+		defaultGateway: procDefaultGateway,
+	}, nil
+}
+
+func (p *gatewayProvider) Name() string {
+	if p.protocol == "" {
+		return "gateway"
+	}
+	return "gateway:" + p.protocol
+}
+
+func (p *gatewayProvider) GetIP(ctx context.Context, isIPv6 bool) (string, error) {
+	if isIPv6 {
+		return "", fmt.Errorf("gateway detection only supports IPv4")
+	}
+
+	var ip string
+	var err error
+	switch p.protocol {
+	case "natpmp":
+		ip, err = p.natpmp(ctx)
+	case "upnp":
+		ip, err = p.upnp(ctx)
+	default:
+		if ip, err = p.natpmp(ctx); err != nil {
+			var upnpErr error
+			if ip, upnpErr = p.upnp(ctx); upnpErr != nil {
+				err = errors.Join(fmt.Errorf("nat-pmp: %w", err), fmt.Errorf("upnp: %w", upnpErr))
+			} else {
+				err = nil
+			}
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if parsed := net.ParseIP(ip); parsed != nil && (parsed.IsPrivate() || cgnat.Contains(parsed)) {
+		return "", fmt.Errorf("gateway reports non-public address %s, likely behind another NAT", ip)
+	}
+
+	return ip, nil
+}
+
+func (p *gatewayProvider) natpmp(ctx context.Context) (string, error) {
+	gateway := p.gateway
+	if gateway == "" {
+		gw, err := p.defaultGateway()
+		if err != nil {
+			return "", fmt.Errorf("find default gateway: %w", err)
+		}
+		gateway = gw.String()
+	}
+	if _, _, err := net.SplitHostPort(gateway); err != nil {
+		gateway = net.JoinHostPort(gateway, strconv.Itoa(p.natpmpPort))
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp4", gateway)
+	if err != nil {
+		return "", fmt.Errorf("dial %s: %w", gateway, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadlineFor(ctx, gatewayTimeout))
+
+	// Version 0, opcode 0: external address request (RFC 6886 section 3.2).
+	if _, err := conn.Write([]byte{0, 0}); err != nil {
+		return "", fmt.Errorf("send request: %w", err)
+	}
+
+	buf := make([]byte, 16)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+
+	return parseNATPMPResponse(buf[:n])
+}
+
+func parseNATPMPResponse(resp []byte) (string, error) {
+	if len(resp) < 12 {
+		return "", fmt.Errorf("nat-pmp response too short: %d bytes", len(resp))
+	}
+	if resp[0] != 0 || resp[1] != 128 {
+		return "", fmt.Errorf("unexpected nat-pmp response version %d opcode %d", resp[0], resp[1])
+	}
+	if code := binary.BigEndian.Uint16(resp[2:]); code != 0 {
+		return "", fmt.Errorf("nat-pmp result code %d", code)
+	}
+	return net.IP(resp[8:12]).String(), nil
+}
+
+func (p *gatewayProvider) upnp(ctx context.Context) (string, error) {
+	location := p.descriptionURL
+	if location == "" {
+		var err error
+		if location, err = p.discoverIGD(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	controlURL, serviceType, err := fetchIGDControlURL(ctx, location)
+	if err != nil {
+		return "", err
+	}
+
+	return getExternalIPAddress(ctx, controlURL, serviceType)
+}
+
+func (p *gatewayProvider) discoverIGD(ctx context.Context) (string, error) {
+	addr, err := net.ResolveUDPAddr("udp4", p.ssdpAddr)
+	if err != nil {
+		return "", err
+	}
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return "", fmt.Errorf("open ssdp socket: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadlineFor(ctx, gatewayTimeout))
+
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(search), addr); err != nil {
+		return "", fmt.Errorf("send ssdp search: %w", err)
+	}
+
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return "", fmt.Errorf("no internet gateway device answered ssdp search: %w", err)
+		}
+
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+
+		if location := resp.Header.Get("Location"); location != "" {
+			return location, nil
+		}
+	}
+}
+
+type igdService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+type igdDevice struct {
+	Services []igdService `xml:"serviceList>service"`
+	Devices  []igdDevice  `xml:"deviceList>device"`
+}
+
+func (d *igdDevice) find(serviceType string) *igdService {
+	for i := range d.Services {
+		if d.Services[i].ServiceType == serviceType {
+			return &d.Services[i]
+		}
+	}
+	for i := range d.Devices {
+		if s := d.Devices[i].find(serviceType); s != nil {
+			return s
+		}
+	}
+	return nil
+}
+
+func fetchIGDControlURL(ctx context.Context, location string) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", location, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("create request: %w", err)
+	}
+
+	resp, err := retry.HTTPClient.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("fetch device description: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("fetch device description: unexpected status: %d", resp.StatusCode)
+	}
+
+	var root struct {
+		URLBase string    `xml:"URLBase"`
+		Device  igdDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&root); err != nil {
+		return "", "", fmt.Errorf("parse device description: %w", err)
+	}
+
+	base, err := url.Parse(location)
+	if err != nil {
+		return "", "", err
+	}
+	if root.URLBase != "" {
+		if base, err = url.Parse(root.URLBase); err != nil {
+			return "", "", fmt.Errorf("parse URLBase: %w", err)
+		}
+	}
+
+	for _, serviceType := range igdServiceTypes {
+		if service := root.Device.find(serviceType); service != nil {
+			control, err := base.Parse(service.ControlURL)
+			if err != nil {
+				return "", "", fmt.Errorf("parse controlURL: %w", err)
+			}
+			return control.String(), serviceType, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("device at %s has no WAN connection service", location)
+}
+
+func getExternalIPAddress(ctx context.Context, controlURL, serviceType string) (string, error) {
+	body := `<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:GetExternalIPAddress xmlns:u="` + serviceType + `"/></s:Body></s:Envelope>`
+
+	req, err := http.NewRequestWithContext(ctx, "POST", controlURL, strings.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+serviceType+`#GetExternalIPAddress"`)
+
+	resp, err := retry.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GetExternalIPAddress: unexpected status: %d", resp.StatusCode)
+	}
+
+	var envelope struct {
+		Body struct {
+			Response struct {
+				IP string `xml:"NewExternalIPAddress"`
+			} `xml:"GetExternalIPAddressResponse"`
+		} `xml:"Body"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&envelope); err != nil {
+		return "", fmt.Errorf("parse GetExternalIPAddress response: %w", err)
+	}
+
+	ip := strings.TrimSpace(envelope.Body.Response.IP)
+	if ip == "" {
+		return "", fmt.Errorf("gateway returned no external address")
+	}
+	return ip, nil
+}
+
+func procDefaultGateway() (net.IP, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil, fmt.Errorf("%w (set gateway explicitly on this platform)", err)
+	}
+	defer f.Close()
+
+	return parseProcRoute(f)
+}
+
+func parseProcRoute(r io.Reader) (net.IP, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// Format: Iface Destination Gateway Flags ... with addresses in little-endian hex.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		return net.IPv4(raw[3], raw[2], raw[1], raw[0]), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, fmt.Errorf("no default route")
+}
+
+func deadlineFor(ctx context.Context, timeout time.Duration) time.Time {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
@@ -0,0 +1,256 @@
+package ip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func startNATPMPServer(t *testing.T, resp []byte) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n == 2 && buf[0] == 0 && buf[1] == 0 {
+				conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func natpmpResponse(code uint16, ip string) []byte {
+	resp := []byte{0, 128, byte(code >> 8), byte(code), 0, 0, 0, 42}
+	return append(resp, net.ParseIP(ip).To4()...)
+}
+
+func startIGDServer(t *testing.T, externalIP string) *httptest.Server {
+	t.Helper()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/rootDesc.xml":
+			fmt.Fprint(w, `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+        <deviceList>
+          <device>
+            <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+            <serviceList>
+              <service>
+                <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+                <controlURL>/ctl/IPConn</controlURL>
+              </service>
+            </serviceList>
+          </device>
+        </deviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`)
+		case r.Method == "POST" && r.URL.Path == "/ctl/IPConn":
+			if got := r.Header.Get("SOAPAction"); got != `"urn:schemas-upnp-org:service:WANIPConnection:1#GetExternalIPAddress"` {
+				t.Errorf("unexpected SOAPAction %q", got)
+			}
+			body, _ := io.ReadAll(r.Body)
+			if !strings.Contains(string(body), "GetExternalIPAddress") {
+				t.Errorf("unexpected SOAP body %s", body)
+			}
+			fmt.Fprintf(w, `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+  <s:Body>
+    <u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+      <NewExternalIPAddress>%s</NewExternalIPAddress>
+    </u:GetExternalIPAddressResponse>
+  </s:Body>
+</s:Envelope>`, externalIP)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestGatewayProviderNATPMP(t *testing.T) {
+	addr := startNATPMPServer(t, natpmpResponse(0, "203.0.113.50"))
+
+	p, err := newGatewayProvider("natpmp", addr, "")
+	if err != nil {
+		t.Fatalf("newGatewayProvider() error = %v", err)
+	}
+
+	ip, err := p.GetIP(context.Background(), false)
+	if err != nil {
+		t.Fatalf("GetIP() error = %v", err)
+	}
+	if ip != "203.0.113.50" {
+		t.Errorf("GetIP() = %q, want 203.0.113.50", ip)
+	}
+}
+
+func TestGatewayProviderNATPMPDefaultGateway(t *testing.T) {
+	addr := startNATPMPServer(t, natpmpResponse(0, "203.0.113.51"))
+	host, port, _ := net.SplitHostPort(addr)
+
+	p, _ := newGatewayProvider("natpmp", "", "")
+	p.natpmpPort, _ = strconv.Atoi(port)
+	p.defaultGateway = func() (net.IP, error) { return net.ParseIP(host), nil }
+
+	if ip, err := p.GetIP(context.Background(), false); err != nil || ip != "203.0.113.51" {
+		t.Errorf("GetIP() = %q, %v; want 203.0.113.51", ip, err)
+	}
+
+	p.defaultGateway = func() (net.IP, error) { return nil, errors.New("no default route") }
+	if _, err := p.GetIP(context.Background(), false); err == nil {
+		t.Error("expected error without a default gateway, got nil")
+	}
+}
+
+func TestGatewayProviderUPnP(t *testing.T) {
+	server := startIGDServer(t, "203.0.113.60")
+
+	p, _ := newGatewayProvider("upnp", "", server.URL+"/rootDesc.xml")
+	ip, err := p.GetIP(context.Background(), false)
+	if err != nil {
+		t.Fatalf("GetIP() error = %v", err)
+	}
+	if ip != "203.0.113.60" {
+		t.Errorf("GetIP() = %q, want 203.0.113.60", ip)
+	}
+}
+
+func TestGatewayProviderSSDPDiscovery(t *testing.T) {
+	server := startIGDServer(t, "203.0.113.61")
+
+	ssdp, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ssdp.Close()
+
+	go func() {
+		buf := make([]byte, 1024)
+		n, addr, err := ssdp.ReadFrom(buf)
+		if err != nil || !strings.Contains(string(buf[:n]), "InternetGatewayDevice") {
+			return
+		}
+		ssdp.WriteTo([]byte("HTTP/1.1 200 OK\r\n"+
+			"CACHE-CONTROL: max-age=120\r\n"+
+			"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n"+
+			"LOCATION: "+server.URL+"/rootDesc.xml\r\n\r\n"), addr)
+	}()
+
+	p, _ := newGatewayProvider("upnp", "", "")
+	p.ssdpAddr = ssdp.LocalAddr().String()
+
+	ip, err := p.GetIP(context.Background(), false)
+	if err != nil {
+		t.Fatalf("GetIP() error = %v", err)
+	}
+	if ip != "203.0.113.61" {
+		t.Errorf("GetIP() = %q, want 203.0.113.61", ip)
+	}
+}
+
+func TestGatewayProviderFallsBackToUPnP(t *testing.T) {
+	natpmp := startNATPMPServer(t, natpmpResponse(2, "0.0.0.0"))
+	server := startIGDServer(t, "203.0.113.62")
+
+	p, _ := newGatewayProvider("", natpmp, server.URL+"/rootDesc.xml")
+	if ip, err := p.GetIP(context.Background(), false); err != nil || ip != "203.0.113.62" {
+		t.Errorf("GetIP() = %q, %v; want 203.0.113.62", ip, err)
+	}
+}
+
+func TestGatewayProviderRejects(t *testing.T) {
+	t.Run("double nat", func(t *testing.T) {
+		addr := startNATPMPServer(t, natpmpResponse(0, "100.64.1.2"))
+		p, _ := newGatewayProvider("natpmp", addr, "")
+		if _, err := p.GetIP(context.Background(), false); err == nil {
+			t.Error("expected error for CGNAT address, got nil")
+		}
+	})
+
+	t.Run("ipv6", func(t *testing.T) {
+		p, _ := newGatewayProvider("", "", "")
+		if _, err := p.GetIP(context.Background(), true); err == nil {
+			t.Error("expected error for IPv6, got nil")
+		}
+	})
+
+	t.Run("unknown protocol", func(t *testing.T) {
+		if _, err := newGatewayProvider("pcp", "", ""); err == nil {
+			t.Error("expected error for unknown protocol, got nil")
+		}
+	})
+}
+
+func TestParseNATPMPResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		resp    []byte
+		want    string
+		wantErr bool
+	}{
+		{"success", natpmpResponse(0, "198.51.100.1"), "198.51.100.1", false},
+		{"result code", natpmpResponse(3, "0.0.0.0"), "", true},
+		{"wrong opcode", append([]byte{0, 129}, natpmpResponse(0, "198.51.100.1")[2:]...), "", true},
+		{"short", []byte{0, 128, 0, 0}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNATPMPResponse(tt.resp)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseNATPMPResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseNATPMPResponse() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseProcRoute(t *testing.T) {
+	input := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	0001A8C0	00000000	0001	0	0	0	00FFFFFF	0	0	0
+eth0	00000000	0101A8C0	0003	0	0	100	00000000	0	0	0
+`
+	gw, err := parseProcRoute(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseProcRoute() error = %v", err)
+	}
+	if gw.String() != "192.168.1.1" {
+		t.Errorf("parseProcRoute() = %s, want 192.168.1.1", gw)
+	}
+
+	if _, err := parseProcRoute(strings.NewReader("Iface\tDestination\tGateway\n")); err == nil {
+		t.Error("expected error without a default route, got nil")
+	}
+}
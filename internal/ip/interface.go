@@ -0,0 +1,183 @@
+package ip
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Address flags from /proc/net/if_inet6 (see linux/if_addr.h).
+const (
+	ifaFlagTemporary  = 0x01
+	ifaFlagDadFailed  = 0x08
+	ifaFlagDeprecated = 0x20
+	ifaFlagTentative  = 0x40
+)
+
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+type interfaceProvider struct {
+	iface       string
+	addrs       func(name string) ([]net.IP, error)
+	defaultName func(isIPv6 bool) (string, error)
+	ipv6Flags   func() (map[string]int, error)
+}
+
+func newInterfaceProvider(iface string) *interfaceProvider {
+	return &interfaceProvider{
+		iface:       iface,
+		addrs:       interfaceAddrs,
+		defaultName: defaultRouteInterface,
+		ipv6Flags:   procIPv6Flags,
+	}
+}
+
+func (p *interfaceProvider) Name() string {
+	if p.iface == "" {
+		return "interface"
+	}
+	return "interface:" + p.iface
+}
+
+func (p *interfaceProvider) GetIP(ctx context.Context, isIPv6 bool) (string, error) {
+	name := p.iface
+	if name == "" {
+		var err error
+		if name, err = p.defaultName(isIPv6); err != nil {
+			return "", fmt.Errorf("find default route interface: %w", err)
+		}
+	}
+
+	addrs, err := p.addrs(name)
+	if err != nil {
+		return "", fmt.Errorf("list addresses on %s: %w", name, err)
+	}
+
+	var flags map[string]int
+	if isIPv6 {
+		// Flags are only available on Linux; elsewhere temporary addresses can't be told apart.
+		flags, _ = p.ipv6Flags()
+	}
+
+	candidates := publicAddrs(addrs, isIPv6, flags)
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no public %s address on %s", familyName(isIPv6), name)
+	}
+
+	return candidates[0].String(), nil
+}
+
+func publicAddrs(addrs []net.IP, isIPv6 bool, flags map[string]int) []net.IP {
+	var result []net.IP
+	for _, addr := range addrs {
+		if (addr.To4() == nil) != isIPv6 {
+			continue
+		}
+		if !addr.IsGlobalUnicast() || addr.IsPrivate() || cgnat.Contains(addr) {
+			continue
+		}
+		if flags[addr.String()]&(ifaFlagTemporary|ifaFlagDeprecated|ifaFlagTentative|ifaFlagDadFailed) != 0 {
+			continue
+		}
+		result = append(result, addr)
+	}
+	return result
+}
+
+func interfaceAddrs(name string) ([]net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+	return ips, nil
+}
+
+func defaultRouteInterface(isIPv6 bool) (string, error) {
+	// Connecting a UDP socket sends no packets but makes the kernel pick the
+	// source address it would use for the default route.
+	network, target := "udp4", "198.51.100.1:53"
+	if isIPv6 {
+		network, target = "udp6", "[2001:db8::1]:53"
+	}
+
+	conn, err := net.Dial(network, target)
+	if err != nil {
+		return "", err
+	}
+	local := conn.LocalAddr().(*net.UDPAddr).IP
+	conn.Close()
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+
+	for _, iface := range ifaces {
+		addrs, err := interfaceAddrs(iface.Name)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if addr.Equal(local) {
+				return iface.Name, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no interface owns source address %s", local)
+}
+
+func procIPv6Flags() (map[string]int, error) {
+	f, err := os.Open("/proc/net/if_inet6")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseIfInet6(f)
+}
+
+func parseIfInet6(r io.Reader) (map[string]int, error) {
+	flags := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		// Format: address ifindex prefixlen scope flags name
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || len(fields[0]) != 32 {
+			continue
+		}
+
+		raw, err := hex.DecodeString(fields[0])
+		if err != nil {
+			continue
+		}
+
+		flag, err := strconv.ParseInt(fields[4], 16, 32)
+		if err != nil {
+			continue
+		}
+
+		flags[net.IP(raw).String()] = int(flag)
+	}
+
+	return flags, scanner.Err()
+}
@@ -0,0 +1,127 @@
+package ip
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func parseIPs(addrs ...string) []net.IP {
+	ips := make([]net.IP, 0, len(addrs))
+	for _, a := range addrs {
+		ips = append(ips, net.ParseIP(a))
+	}
+	return ips
+}
+
+func TestPublicAddrs(t *testing.T) {
+	addrs := parseIPs(
+		"127.0.0.1",
+		"10.0.0.5",
+		"192.168.1.10",
+		"100.64.12.1",
+		"169.254.3.3",
+		"203.0.113.10",
+		"::1",
+		"fe80::1",
+		"fd12:3456::1",
+		"2001:db8::aaaa",
+		"2001:db8::bbbb",
+		"2001:db8::cccc",
+	)
+	flags := map[string]int{
+		"2001:db8::aaaa": ifaFlagTemporary,
+		"2001:db8::bbbb": ifaFlagDeprecated,
+	}
+
+	v4 := publicAddrs(addrs, false, flags)
+	if len(v4) != 1 || v4[0].String() != "203.0.113.10" {
+		t.Errorf("expected only 203.0.113.10, got %v", v4)
+	}
+
+	v6 := publicAddrs(addrs, true, flags)
+	if len(v6) != 1 || v6[0].String() != "2001:db8::cccc" {
+		t.Errorf("expected only 2001:db8::cccc, got %v", v6)
+	}
+
+	withoutFlags := publicAddrs(addrs, true, nil)
+	if len(withoutFlags) != 3 {
+		t.Errorf("expected 3 global IPv6 addresses without flag data, got %v", withoutFlags)
+	}
+}
+
+func TestInterfaceProviderGetIP(t *testing.T) {
+	newProvider := func(iface string, addrs []net.IP) *interfaceProvider {
+		return &interfaceProvider{
+			iface: iface,
+			addrs: func(name string) ([]net.IP, error) {
+				if name != "eth0" {
+					return nil, errors.New("no such network interface")
+				}
+				return addrs, nil
+			},
+			defaultName: func(isIPv6 bool) (string, error) { return "eth0", nil },
+			ipv6Flags:   func() (map[string]int, error) { return nil, errors.New("not supported") },
+		}
+	}
+	ctx := context.Background()
+
+	p := newProvider("eth0", parseIPs("192.168.1.10", "203.0.113.10", "fe80::1", "2001:db8::1"))
+	if ip, err := p.GetIP(ctx, false); err != nil || ip != "203.0.113.10" {
+		t.Errorf("GetIP(ipv4) = %q, %v; want 203.0.113.10", ip, err)
+	}
+	if ip, err := p.GetIP(ctx, true); err != nil || ip != "2001:db8::1" {
+		t.Errorf("GetIP(ipv6) = %q, %v; want 2001:db8::1", ip, err)
+	}
+	if p.Name() != "interface:eth0" {
+		t.Errorf("Name() = %q, want interface:eth0", p.Name())
+	}
+
+	defaultRoute := newProvider("", parseIPs("203.0.113.10"))
+	if ip, err := defaultRoute.GetIP(ctx, false); err != nil || ip != "203.0.113.10" {
+		t.Errorf("GetIP() via default route = %q, %v; want 203.0.113.10", ip, err)
+	}
+
+	privateOnly := newProvider("eth0", parseIPs("10.0.0.5", "fd00::1"))
+	if _, err := privateOnly.GetIP(ctx, false); err == nil || !strings.Contains(err.Error(), "no public IPv4 address on eth0") {
+		t.Errorf("expected no public address error, got %v", err)
+	}
+
+	missing := newProvider("wg0", nil)
+	if _, err := missing.GetIP(ctx, false); err == nil {
+		t.Error("expected error for unknown interface, got nil")
+	}
+}
+
+func TestParseIfInet6(t *testing.T) {
+	input := `00000000000000000000000000000001 01 80 10 80       lo
+fe800000000000000000000000000001 02 40 20 80     eth0
+20010db8000000000000000000000aaa 02 40 00 01     eth0
+20010db8000000000000000000000bbb 02 40 00 00     eth0
+20010db8000000000000000000000ccc 02 40 00 20     eth0
+garbage line
+`
+
+	flags, err := parseIfInet6(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseIfInet6() error = %v", err)
+	}
+
+	want := map[string]int{
+		"::1":           0x80,
+		"fe80::1":       0x80,
+		"2001:db8::aaa": ifaFlagTemporary,
+		"2001:db8::bbb": 0,
+		"2001:db8::ccc": ifaFlagDeprecated,
+	}
+	if len(flags) != len(want) {
+		t.Fatalf("expected %d entries, got %v", len(want), flags)
+	}
+	for addr, flag := range want {
+		if flags[addr] != flag {
+			t.Errorf("flags[%s] = %#x, want %#x", addr, flags[addr], flag)
+		}
+	}
+}
@@ -12,36 +12,6 @@ import (
 	"github.com/oberwager/cloudflare-ddns/internal/retry"
 )
 
-func GetWithRetry(ctx context.Context, url string, isIPv6 bool) (string, error) {
-	var result string
-	config := retry.DefaultConfig()
-
-	ipType := "IPv4"
-	if isIPv6 {
-		ipType = "IPv6"
-	}
-
-	err := retry.WithBackoff(ctx, fmt.Sprintf("get %s", ipType), config, func() error {
-		ip, err := getIP(ctx, url)
-		if err != nil {
-			return err
-		}
-
-		if err := validateIP(ip, isIPv6); err != nil {
-			return fmt.Errorf("validation failed: %w", err)
-		}
-
-		result = ip
-		return nil
-	})
-
-	if err != nil {
-		return "", err
-	}
-
-	return result, nil
-}
-
 func getIP(ctx context.Context, url string) (string, error) {
 	slog.Debug("fetching ip address", "url", url)
 
@@ -112,71 +112,3 @@ func TestGetIP(t *testing.T) {
 		})
 	}
 }
-
-func TestGetIPWithRetry(t *testing.T) {
-	t.Run("successful on first attempt", func(t *testing.T) {
-		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("192.168.1.1"))
-		}))
-		defer server.Close()
-
-		ctx := context.Background()
-		ip, err := GetWithRetry(ctx, server.URL, false)
-
-		if err != nil {
-			t.Fatalf("expected no error, got %v", err)
-		}
-		if ip != "192.168.1.1" {
-			t.Errorf("expected 192.168.1.1, got %s", ip)
-		}
-	})
-
-	t.Run("successful ipv6", func(t *testing.T) {
-		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("2001:0db8::1"))
-		}))
-		defer server.Close()
-
-		ctx := context.Background()
-		ip, err := GetWithRetry(ctx, server.URL, true)
-
-		if err != nil {
-			t.Fatalf("expected no error, got %v", err)
-		}
-		if ip != "2001:0db8::1" {
-			t.Errorf("expected 2001:0db8::1, got %s", ip)
-		}
-	})
-
-	t.Run("validation failure", func(t *testing.T) {
-		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("192.168.1.1"))
-		}))
-		defer server.Close()
-
-		ctx := context.Background()
-		_, err := GetWithRetry(ctx, server.URL, true)
-
-		if err == nil {
-			t.Fatal("expected error for ipv4 when expecting ipv6, got nil")
-		}
-	})
-
-	t.Run("invalid ip format", func(t *testing.T) {
-		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("not-an-ip"))
-		}))
-		defer server.Close()
-
-		ctx := context.Background()
-		_, err := GetWithRetry(ctx, server.URL, false)
-
-		if err == nil {
-			t.Fatal("expected error for invalid ip, got nil")
-		}
-	})
-}
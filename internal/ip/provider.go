@@ -0,0 +1,115 @@
+package ip
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/oberwager/cloudflare-ddns/internal/config"
+)
+
+type Provider interface {
+	Name() string
+	GetIP(ctx context.Context, isIPv6 bool) (string, error)
+}
+
+func NewProvider(spec config.IPProvider) (Provider, error) {
+	switch spec.Type {
+	case "ipify":
+		return &httpProvider{
+			name:    "ipify",
+			ipv4URL: "https://api.ipify.org",
+			ipv6URL: "https://api6.ipify.org",
+		}, nil
+	case "icanhazip":
+		return &httpProvider{
+			name:    "icanhazip",
+			ipv4URL: "https://ipv4.icanhazip.com",
+			ipv6URL: "https://ipv6.icanhazip.com",
+		}, nil
+	case "cloudflare":
+		return &httpProvider{
+			name:    "cloudflare",
+			ipv4URL: "https://1.1.1.1/cdn-cgi/trace",
+			ipv6URL: "https://[2606:4700:4700::1111]/cdn-cgi/trace",
+			parse:   parseTrace,
+		}, nil
+	case "aws":
+		return &httpProvider{
+			name:    "aws",
+			ipv4URL: "https://checkip.amazonaws.com",
+		}, nil
+	case "custom":
+		if spec.URL == "" {
+			return nil, fmt.Errorf("custom provider requires a url")
+		}
+		return &httpProvider{
+			name:    "custom",
+			ipv4URL: spec.URL,
+			ipv6URL: spec.URL,
+		}, nil
+	case "interface":
+		return newInterfaceProvider(spec.Interface), nil
+	case "dns":
+		p, err := newDNSProvider(spec.Resolver, spec.Server)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	case "gateway":
+		p, err := newGatewayProvider(spec.Protocol, spec.Gateway, spec.URL)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	default:
+		return nil, fmt.Errorf("unknown ip provider type: %q", spec.Type)
+	}
+}
+
+type httpProvider struct {
+	name    string
+	ipv4URL string
+	ipv6URL string
+	parse   func(body string) (string, error)
+}
+
+func (p *httpProvider) Name() string {
+	return p.name
+}
+
+func (p *httpProvider) GetIP(ctx context.Context, isIPv6 bool) (string, error) {
+	url := p.ipv4URL
+	if isIPv6 {
+		url = p.ipv6URL
+	}
+	if url == "" {
+		return "", fmt.Errorf("%s does not support %s", p.name, familyName(isIPv6))
+	}
+
+	body, err := getIP(ctx, url)
+	if err != nil {
+		return "", err
+	}
+
+	if p.parse != nil {
+		return p.parse(body)
+	}
+	return body, nil
+}
+
+func parseTrace(body string) (string, error) {
+	for _, line := range strings.Split(body, "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok && key == "ip" {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("no ip field in trace response")
+}
+
+func familyName(isIPv6 bool) string {
+	if isIPv6 {
+		return "IPv6"
+	}
+	return "IPv4"
+}
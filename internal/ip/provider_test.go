@@ -0,0 +1,114 @@
+package ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oberwager/cloudflare-ddns/internal/config"
+)
+
+func TestNewProvider(t *testing.T) {
+	tests := []struct {
+		name         string
+		providerType string
+		url          string
+		wantName     string
+		wantErr      bool
+	}{
+		{"ipify", "ipify", "", "ipify", false},
+		{"icanhazip", "icanhazip", "", "icanhazip", false},
+		{"cloudflare", "cloudflare", "", "cloudflare", false},
+		{"aws", "aws", "", "aws", false},
+		{"custom", "custom", "https://ip.example.com", "custom", false},
+		{"custom without url", "custom", "", "", true},
+		{"interface", "interface", "", "interface", false},
+		{"unknown type", "whatismyip", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewProvider(config.IPProvider{Type: tt.providerType, URL: tt.url})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewProvider() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && p.Name() != tt.wantName {
+				t.Errorf("Name() = %q, want %q", p.Name(), tt.wantName)
+			}
+		})
+	}
+}
+
+func TestNewProviderErrorReturnsNil(t *testing.T) {
+	// A typed nil inside the Provider interface would pass a p != nil check.
+	for _, spec := range []config.IPProvider{
+		{Type: "custom"},
+		{Type: "dns", Resolver: "nope"},
+		{Type: "gateway", Protocol: "nope"},
+	} {
+		if p, err := NewProvider(spec); err == nil || p != nil {
+			t.Errorf("NewProvider(%+v) = %#v, %v, want nil and an error", spec, p, err)
+		}
+	}
+}
+
+func TestHTTPProviderGetIP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/plain":
+			w.Write([]byte("203.0.113.7\n"))
+		case "/trace":
+			w.Write([]byte("fl=123abc\nh=1.1.1.1\nip=2001:db8::7\nts=1700000000.000\nvisit_scheme=https\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	custom, err := NewProvider(config.IPProvider{Type: "custom", URL: server.URL + "/plain"})
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	if ip, err := custom.GetIP(ctx, false); err != nil || ip != "203.0.113.7" {
+		t.Errorf("custom GetIP() = %q, %v; want 203.0.113.7", ip, err)
+	}
+
+	trace := &httpProvider{name: "cloudflare", ipv6URL: server.URL + "/trace", parse: parseTrace}
+	if ip, err := trace.GetIP(ctx, true); err != nil || ip != "2001:db8::7" {
+		t.Errorf("trace GetIP() = %q, %v; want 2001:db8::7", ip, err)
+	}
+
+	aws, _ := NewProvider(config.IPProvider{Type: "aws"})
+	if _, err := aws.GetIP(ctx, true); err == nil {
+		t.Error("expected aws provider to reject IPv6, got nil error")
+	}
+}
+
+func TestParseTrace(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{"ipv4", "fl=1\nip=198.51.100.4\nts=1", "198.51.100.4", false},
+		{"crlf", "fl=1\r\nip=198.51.100.4\r\nts=1", "198.51.100.4", false},
+		{"missing ip", "fl=1\nts=1", "", true},
+		{"empty", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTrace(tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTrace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseTrace() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
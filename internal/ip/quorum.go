@@ -0,0 +1,127 @@
+package ip
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/oberwager/cloudflare-ddns/internal/retry"
+	"github.com/oberwager/cloudflare-ddns/internal/tracing"
+)
+
+type Quorum struct {
+	providers []Provider
+	required  int
+}
+
+func NewQuorum(required int, providers ...Provider) *Quorum {
+	return &Quorum{providers: providers, required: required}
+}
+
+func (q *Quorum) Name() string {
+	return "quorum"
+}
+
+type vote struct {
+	provider string
+	ip       string
+	err      error
+}
+
+// answer is one address and the providers that reported it, as logged when
+// providers disagree.
+type answer struct {
+	IP        string   `json:"ip"`
+	Providers []string `json:"providers"`
+}
+
+func (q *Quorum) GetIP(ctx context.Context, isIPv6 bool) (string, error) {
+	if q.required < 1 || q.required > len(q.providers) {
+		return "", fmt.Errorf("quorum of %d is not achievable with %d providers", q.required, len(q.providers))
+	}
+
+	ipType := familyName(isIPv6)
+	votes := make([]vote, len(q.providers))
+	var wg sync.WaitGroup
+
+	for i, p := range q.providers {
+		wg.Add(1)
+		go func(i int, p Provider) {
+			defer wg.Done()
+
+			ctx, span := tracing.StartClient(ctx, "ip provider", tracing.String("provider", p.Name()), tracing.String("ip.family", ipType))
+			var result string
+			err := retry.WithBackoff(ctx, fmt.Sprintf("get %s from %s", ipType, p.Name()), chainRetryConfig, func() error {
+				ip, err := p.GetIP(ctx, isIPv6)
+				if err != nil {
+					return err
+				}
+
+				if err := validateIP(ip, isIPv6); err != nil {
+					return fmt.Errorf("validation failed: %w", err)
+				}
+
+				// Normalise so "2001:0db8::1" and "2001:db8::1" count as the same answer.
+				result = net.ParseIP(ip).String()
+				return nil
+			})
+			span.SetAttributes(tracing.String("ip", result))
+			span.End(err)
+			votes[i] = vote{provider: p.Name(), ip: result, err: err}
+		}(i, p)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("context cancelled during %s quorum: %w", ipType, ctx.Err())
+	}
+
+	tally := make(map[string][]string)
+	var failed []string
+	for _, v := range votes {
+		if v.err != nil {
+			slog.WarnContext(ctx, "ip provider failed", "provider", v.provider, "type", ipType, "error", v.err)
+			failed = append(failed, v.provider)
+			continue
+		}
+		tally[v.ip] = append(tally[v.ip], v.provider)
+	}
+
+	candidates := make([]string, 0, len(tally))
+	for ip := range tally {
+		candidates = append(candidates, ip)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if len(tally[candidates[i]]) != len(tally[candidates[j]]) {
+			return len(tally[candidates[i]]) > len(tally[candidates[j]])
+		}
+		return candidates[i] < candidates[j]
+	})
+
+	if len(candidates) > 1 {
+		// Addresses are values rather than keys, so log fields stay fixed.
+		answers := make([]answer, len(candidates))
+		for i, ip := range candidates {
+			answers[i] = answer{IP: ip, Providers: tally[ip]}
+		}
+		slog.WarnContext(ctx, "ip providers disagree", "type", ipType, "votes", answers)
+	}
+
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no %s quorum: all %d providers failed", ipType, len(failed))
+	}
+
+	winner := candidates[0]
+	agreed := len(tally[winner])
+	tied := len(candidates) > 1 && len(tally[candidates[1]]) == agreed
+	if agreed < q.required || tied {
+		return "", fmt.Errorf("no %s quorum: best answer %s from %d of %d providers, %d required",
+			ipType, winner, agreed, len(q.providers), q.required)
+	}
+
+	slog.DebugContext(ctx, "ip quorum reached", "type", ipType, "ip", winner, "agreed", agreed, "required", q.required)
+	return winner, nil
+}
@@ -0,0 +1,149 @@
+package ip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+func TestQuorum(t *testing.T) {
+	tests := []struct {
+		name      string
+		required  int
+		providers []Provider
+		isIPv6    bool
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:     "unanimous",
+			required: 2,
+			providers: []Provider{
+				&stubProvider{name: "a", ip: "198.51.100.1"},
+				&stubProvider{name: "b", ip: "198.51.100.1"},
+				&stubProvider{name: "c", ip: "198.51.100.1"},
+			},
+			want: "198.51.100.1",
+		},
+		{
+			name:     "majority with one liar",
+			required: 2,
+			providers: []Provider{
+				&stubProvider{name: "a", ip: "198.51.100.1"},
+				&stubProvider{name: "b", ip: "203.0.113.66"},
+				&stubProvider{name: "c", ip: "198.51.100.1"},
+			},
+			want: "198.51.100.1",
+		},
+		{
+			name:     "majority with one failure",
+			required: 2,
+			providers: []Provider{
+				&stubProvider{name: "a", ip: "198.51.100.1"},
+				&stubProvider{name: "b", err: errors.New("unexpected status: 503")},
+				&stubProvider{name: "c", ip: "198.51.100.1"},
+			},
+			want: "198.51.100.1",
+		},
+		{
+			name:     "ipv6 normalised before counting",
+			required: 2,
+			isIPv6:   true,
+			providers: []Provider{
+				&stubProvider{name: "a", ip: "2001:0db8:0000::0001"},
+				&stubProvider{name: "b", ip: "2001:db8::1"},
+			},
+			want: "2001:db8::1",
+		},
+		{
+			name:     "split result",
+			required: 2,
+			providers: []Provider{
+				&stubProvider{name: "a", ip: "198.51.100.1"},
+				&stubProvider{name: "b", ip: "203.0.113.66"},
+				&stubProvider{name: "c", err: errors.New("unexpected status: 503")},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "tie at required count",
+			required: 1,
+			providers: []Provider{
+				&stubProvider{name: "a", ip: "198.51.100.1"},
+				&stubProvider{name: "b", ip: "203.0.113.66"},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "invalid answers do not vote",
+			required: 2,
+			providers: []Provider{
+				&stubProvider{name: "a", ip: "198.51.100.1"},
+				&stubProvider{name: "b", ip: "not-an-ip"},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "all failed",
+			required: 1,
+			providers: []Provider{
+				&stubProvider{name: "a", err: errors.New("unexpected status: 503")},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "quorum larger than provider count",
+			required: 3,
+			providers: []Provider{
+				&stubProvider{name: "a", ip: "198.51.100.1"},
+				&stubProvider{name: "b", ip: "198.51.100.1"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFastChainRetries(t)
+
+			got, err := NewQuorum(tt.required, tt.providers...).GetIP(context.Background(), tt.isIPv6)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetIP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuorumDisagreementLog(t *testing.T) {
+	var buf bytes.Buffer
+	original := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(original) })
+
+	q := NewQuorum(2,
+		&stubProvider{name: "a", ip: "198.51.100.1"},
+		&stubProvider{name: "b", ip: "203.0.113.66"},
+		&stubProvider{name: "c", ip: "198.51.100.1"},
+	)
+	if _, err := q.GetIP(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+
+	var entry struct {
+		Msg   string   `json:"msg"`
+		Votes []answer `json:"votes"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected one JSON log line, got %q: %v", buf.String(), err)
+	}
+	if entry.Msg != "ip providers disagree" || len(entry.Votes) != 2 ||
+		entry.Votes[0].IP != "198.51.100.1" || len(entry.Votes[0].Providers) != 2 || entry.Votes[1].IP != "203.0.113.66" {
+		t.Errorf("unexpected log entry: %s", buf.String())
+	}
+}
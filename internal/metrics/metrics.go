@@ -0,0 +1,262 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	Detections = NewCounter("cloudflare_ddns_ip_detections_total",
+		"Public IP detections by address family and result.", "family", "result")
+	Records = NewCounter("cloudflare_ddns_records_total",
+		"Reconciled DNS records by outcome and record type.", "outcome", "type")
+	APIRequestDuration = NewHistogram("cloudflare_ddns_api_request_duration_seconds",
+		"Cloudflare API request latency by method and HTTP status.", DefaultBuckets, "method", "status")
+	RetryAttempts = NewCounter("cloudflare_ddns_retry_attempts_total",
+		"Retry attempts made after a failed operation.")
+	DetectedIP = NewGauge("cloudflare_ddns_detected_ip_info",
+		"Currently detected IP address, always 1.", "source", "family", "ip")
+	LastSuccess = NewGauge("cloudflare_ddns_last_success_timestamp_seconds",
+		"Unix time of the last run that updated every record.")
+)
+
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// The exposition format is simple enough that a client library isn't worth
+// the dependency; metrics register themselves here in declaration order.
+var registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+func register(m metric) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.metrics = append(registry.metrics, m)
+}
+
+// vec holds one value per label combination.
+type vec[T any] struct {
+	name, help, kind string
+	labels           []string
+	mu               sync.Mutex
+	series           map[string]*T
+}
+
+func (v *vec[T]) get(values []string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = new(T)
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *vec[T]) Reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	clear(v.series)
+}
+
+func (v *vec[T]) each(w io.Writer, fn func(labels string, s *T)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.kind)
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fn(formatLabels(v.labels, k), v.series[k])
+	}
+}
+
+type Counter struct{ vec[float64] }
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{vec[float64]{name: name, help: help, kind: "counter", labels: labels, series: map[string]*float64{}}}
+	if len(labels) == 0 {
+		c.series[""] = new(float64)
+	}
+	register(c)
+	return c
+}
+
+func (c *Counter) Inc(values ...string) { c.Add(1, values...) }
+
+func (c *Counter) Add(delta float64, values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.get(values) += delta
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.each(w, func(labels string, v *float64) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labels, formatFloat(*v))
+	})
+}
+
+type Gauge struct{ vec[float64] }
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{vec[float64]{name: name, help: help, kind: "gauge", labels: labels, series: map[string]*float64{}}}
+	if len(labels) == 0 {
+		g.series[""] = new(float64)
+	}
+	register(g)
+	return g
+}
+
+func (g *Gauge) Set(v float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	*g.get(values) = v
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.each(w, func(labels string, v *float64) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, labels, formatFloat(*v))
+	})
+}
+
+type histogramSeries struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+type Histogram struct {
+	vec[histogramSeries]
+	buckets []float64
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		vec:     vec[histogramSeries]{name: name, help: help, kind: "histogram", labels: labels, series: map[string]*histogramSeries{}},
+		buckets: buckets,
+	}
+	register(h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.get(values)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.each(w, func(labels string, s *histogramSeries) {
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, withLabel(labels, "le", formatFloat(upper)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, withLabel(labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels, s.count)
+	})
+}
+
+// Write renders every registered metric in the Prometheus text format.
+func Write(w io.Writer) {
+	registry.mu.Lock()
+	metrics := append([]metric(nil), registry.metrics...)
+	registry.mu.Unlock()
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+	})
+}
+
+// Push replaces the metrics of job on a Prometheus Pushgateway.
+func Push(ctx context.Context, client *http.Client, gateway, job string) error {
+	var body bytes.Buffer
+	Write(&body)
+
+	target := strings.TrimSuffix(gateway, "/") + "/metrics/job/" + url.PathEscape(job)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, &body)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("push metrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push metrics: HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// labelEscaper escapes label values as the text exposition format defines:
+// only backslash, double quote and line feed.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names []string, key string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	values := strings.Split(key, "\xff")
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + labelEscaper.Replace(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func withLabel(labels, name, value string) string {
+	pair := name + `="` + labelEscaper.Replace(value) + `"`
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
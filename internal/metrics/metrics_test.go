@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	registry.mu.Lock()
+	saved := registry.metrics
+	registry.metrics = nil
+	registry.mu.Unlock()
+	defer func() { registry.metrics = saved }()
+
+	counter := NewCounter("test_total", "A counter.", "kind")
+	counter.Inc("b")
+	counter.Add(2, "a")
+	counter.Inc("b")
+
+	gauge := NewGauge("test_info", "A gauge.", "ip")
+	gauge.Set(1, "1.2.3.4")
+	gauge.Reset()
+	gauge.Set(1, `5.6.7.8"`)
+
+	plain := NewGauge("test_timestamp", "An unlabeled gauge.")
+
+	hist := NewHistogram("test_seconds", "A histogram.", []float64{0.1, 1}, "method")
+	hist.Observe(0.05, "GET")
+	hist.Observe(0.5, "GET")
+	hist.Observe(5, "GET")
+
+	var out strings.Builder
+	Write(&out)
+
+	want := `# HELP test_total A counter.
+# TYPE test_total counter
+test_total{kind="a"} 2
+test_total{kind="b"} 2
+# HELP test_info A gauge.
+# TYPE test_info gauge
+test_info{ip="5.6.7.8\""} 1
+# HELP test_timestamp An unlabeled gauge.
+# TYPE test_timestamp gauge
+test_timestamp 0
+# HELP test_seconds A histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{method="GET",le="0.1"} 1
+test_seconds_bucket{method="GET",le="1"} 2
+test_seconds_bucket{method="GET",le="+Inf"} 3
+test_seconds_sum{method="GET"} 5.55
+test_seconds_count{method="GET"} 3
+`
+	if out.String() != want {
+		t.Errorf("Write() =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	plain.Set(42)
+	out.Reset()
+	Write(&out)
+	if !strings.Contains(out.String(), "test_timestamp 42\n") {
+		t.Errorf("expected updated gauge, got\n%s", out.String())
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	got := formatLabels([]string{"name"}, "café \"home\"\\\n\t")
+	want := `{name="café \"home\"\\\n` + "\t" + `"}`
+	if got != want {
+		t.Errorf("formatLabels() = %s, want %s", got, want)
+	}
+}
+
+func TestLabelCountMismatch(t *testing.T) {
+	c := &Counter{vec[float64]{name: "test_total", labels: []string{"a", "b"}, series: map[string]*float64{}}}
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for wrong label count")
+		}
+	}()
+	c.Inc("only-one")
+}
+
+func TestHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "# TYPE cloudflare_ddns_records_total counter") {
+		t.Errorf("expected default metrics, got\n%s", rec.Body.String())
+	}
+}
+
+func TestPush(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "accepted", status: http.StatusOK},
+		{name: "rejected", status: http.StatusBadRequest, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var method, path, body string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+				method, path, body = r.Method, r.URL.Path, string(data)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			err := Push(context.Background(), server.Client(), server.URL+"/", "cloudflare-ddns")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Push() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if method != "PUT" || path != "/metrics/job/cloudflare-ddns" {
+				t.Errorf("got %s %s, want PUT /metrics/job/cloudflare-ddns", method, path)
+			}
+			if !strings.Contains(body, "cloudflare_ddns_last_success_timestamp_seconds") {
+				t.Errorf("expected metrics in body, got\n%s", body)
+			}
+		})
+	}
+}
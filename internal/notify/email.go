@@ -0,0 +1,151 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oberwager/cloudflare-ddns/internal/config"
+	"github.com/oberwager/cloudflare-ddns/internal/retry"
+)
+
+const smtpTimeout = 30 * time.Second
+
+// rootCAs verifies SMTP server certificates. nil uses the system pool.
+var rootCAs *x509.CertPool
+
+// sendEmail delivers the message over SMTP. The tls mode is "starttls"
+// (default, port 587), "tls" for implicit TLS (port 465) or "none" (port 25).
+func sendEmail(ctx context.Context, n config.Notifier, text string, msg Message) error {
+	mode := n.TLS
+	if mode == "" {
+		mode = "starttls"
+	}
+	port := n.Port
+	if port == 0 {
+		port = map[string]int{"starttls": 587, "tls": 465, "none": 25}[mode]
+	}
+	addr := net.JoinHostPort(n.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: n.Host, RootCAs: rootCAs}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	if mode == "tls" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connect to %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	c, err := smtp.NewClient(conn, n.Host)
+	if err != nil {
+		conn.Close()
+		return smtpError("greeting", err)
+	}
+	defer c.Close()
+
+	if mode == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return retry.Permanent(fmt.Errorf("%s does not support STARTTLS", addr))
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return smtpError("starttls", err)
+		}
+	}
+
+	if n.Username != "" {
+		// PlainAuth refuses to send credentials over an unencrypted connection
+		// to anything but localhost.
+		if err := c.Auth(smtp.PlainAuth("", n.Username, n.Password, n.Host)); err != nil {
+			return smtpError("auth", err)
+		}
+	}
+
+	from, err := mail.ParseAddress(n.From)
+	if err != nil {
+		return retry.Permanent(fmt.Errorf("parse from address: %w", err))
+	}
+	to, err := mail.ParseAddressList(strings.Join(n.To, ", "))
+	if err != nil {
+		return retry.Permanent(fmt.Errorf("parse to addresses: %w", err))
+	}
+
+	if err := c.Mail(from.Address); err != nil {
+		return smtpError("mail from", err)
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt.Address); err != nil {
+			return smtpError("rcpt to "+rcpt.Address, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return smtpError("data", err)
+	}
+	if _, err := w.Write(emailBody(from, to, text, msg)); err != nil {
+		return smtpError("data", err)
+	}
+	if err := w.Close(); err != nil {
+		return smtpError("data", err)
+	}
+
+	// The server has accepted the message, so a failed QUIT must not lead to
+	// a retry that delivers it twice.
+	if err := c.Quit(); err != nil {
+		slog.DebugContext(ctx, "smtp quit failed after the message was accepted", "host", n.Host, "error", err)
+	}
+	return nil
+}
+
+func emailBody(from *mail.Address, to []*mail.Address, text string, msg Message) []byte {
+	recipients := make([]string, len(to))
+	for i, addr := range to {
+		recipients[i] = addr.String()
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Title()))
+	fmt.Fprintf(&b, "Date: %s\r\n", msg.Time.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&b)
+	qp.Write([]byte(strings.ReplaceAll(text, "\n", "\r\n")))
+	qp.Close()
+	return b.Bytes()
+}
+
+// smtpError marks permanent (5xx) replies so they aren't retried. Transient
+// (4xx) replies and connection errors are retried.
+func smtpError(step string, err error) error {
+	err = fmt.Errorf("%s: %w", step, err)
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		if reply.Code >= 500 {
+			return retry.Permanent(err)
+		}
+		return retry.Retryable(err, 0)
+	}
+	return err
+}
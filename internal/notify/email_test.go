@@ -0,0 +1,366 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/oberwager/cloudflare-ddns/internal/config"
+)
+
+type smtpMessage struct {
+	From string
+	To   []string
+	Auth string
+	TLS  bool
+	Data string
+}
+
+// smtpStandIn is a minimal SMTP server that records delivered messages.
+type smtpStandIn struct {
+	host     string
+	port     int
+	starttls bool
+	tls      *tls.Config
+
+	mu          sync.Mutex
+	connections int
+	messages    []smtpMessage
+	rcptReplies []string
+	dropOnQuit  bool
+}
+
+// startSMTP listens on localhost. With implicitTLS the whole connection is
+// TLS, otherwise STARTTLS is offered when starttls is set.
+func startSMTP(t *testing.T, implicitTLS, starttls bool) *smtpStandIn {
+	t.Helper()
+
+	// Borrow the httptest certificate, which is valid for 127.0.0.1.
+	ts := httptest.NewTLSServer(nil)
+	cert := ts.TLS.Certificates[0]
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	ts.Close()
+
+	original := rootCAs
+	rootCAs = pool
+	t.Cleanup(func() { rootCAs = original })
+
+	s := &smtpStandIn{starttls: starttls, tls: &tls.Config{Certificates: []tls.Certificate{cert}}}
+	var ln net.Listener
+	var err error
+	if implicitTLS {
+		ln, err = tls.Listen("tcp", "127.0.0.1:0", s.tls)
+	} else {
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	s.host = host
+	s.port, _ = strconv.Atoi(port)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, implicitTLS)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStandIn) serve(conn net.Conn, secure bool) {
+	defer conn.Close()
+	s.mu.Lock()
+	s.connections++
+	s.mu.Unlock()
+
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP stand-in")
+	msg := smtpMessage{TLS: secure}
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-localhost")
+			if s.starttls && !msg.TLS {
+				tp.PrintfLine("250-STARTTLS")
+			}
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			tp.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, tp, msg.TLS = tlsConn, textproto.NewConn(tlsConn), true
+		case "AUTH":
+			_, encoded, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(encoded)
+			parts := strings.Split(string(decoded), "\x00")
+			if len(parts) != 3 || parts[2] != "secret" {
+				tp.PrintfLine("535 5.7.8 authentication failed")
+				continue
+			}
+			msg.Auth = parts[1]
+			tp.PrintfLine("235 2.7.0 authenticated")
+		case "MAIL":
+			msg.From = strings.TrimPrefix(arg, "FROM:")
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			s.mu.Lock()
+			var reply string
+			if len(s.rcptReplies) > 0 {
+				reply, s.rcptReplies = s.rcptReplies[0], s.rcptReplies[1:]
+			}
+			s.mu.Unlock()
+			if reply != "" {
+				tp.PrintfLine("%s", reply)
+				continue
+			}
+			msg.To = append(msg.To, strings.TrimPrefix(arg, "TO:"))
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.Data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			s.mu.Lock()
+			drop := s.dropOnQuit
+			s.mu.Unlock()
+			if !drop {
+				tp.PrintfLine("221 bye")
+			}
+			return
+		default:
+			tp.PrintfLine("502 command not implemented")
+		}
+	}
+}
+
+func (s *smtpStandIn) received() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.messages
+}
+
+func (s *smtpStandIn) connectionCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections
+}
+
+func (s *smtpStandIn) notifier(mode string) config.Notifier {
+	return config.Notifier{
+		Type: "email", Host: s.host, Port: s.port, TLS: mode,
+		Username: "ddns", Password: "secret",
+		From: "DDNS <ddns@example.com>", To: []string{"ops@example.com", "Home Owner <owner@example.com>"},
+	}
+}
+
+func TestSendEmail(t *testing.T) {
+	tests := []struct {
+		name        string
+		implicitTLS bool
+		mode        string
+	}{
+		{"starttls", false, "starttls"},
+		{"implicit tls", true, "tls"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startSMTP(t, tt.implicitTLS, true)
+			msg := Message{Status: "total_failure", Error: "get IPv4: timeout"}
+
+			if err := sendEmail(context.Background(), server.notifier(tt.mode), "Run failed: get IPv4: timeout", msg); err != nil {
+				t.Fatal(err)
+			}
+
+			got := server.received()
+			if len(got) != 1 {
+				t.Fatalf("expected 1 message, got %d", len(got))
+			}
+			m := got[0]
+			if !m.TLS || m.Auth != "ddns" {
+				t.Errorf("expected an authenticated TLS session, got tls=%v auth=%q", m.TLS, m.Auth)
+			}
+			if m.From != "<ddns@example.com>" || strings.Join(m.To, ",") != "<ops@example.com>,<owner@example.com>" {
+				t.Errorf("unexpected envelope: from %s, to %v", m.From, m.To)
+			}
+
+			parsed, err := mail.ReadMessage(strings.NewReader(m.Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if subject := parsed.Header.Get("Subject"); subject != "cloudflare-ddns run failed" {
+				t.Errorf("Subject = %q", subject)
+			}
+			if to := parsed.Header.Get("To"); to != `<ops@example.com>, "Home Owner" <owner@example.com>` {
+				t.Errorf("To = %q", to)
+			}
+			body, _ := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+			if strings.TrimSpace(string(body)) != "Run failed: get IPv4: timeout" {
+				t.Errorf("body = %q", body)
+			}
+		})
+	}
+}
+
+func TestSendEmailRequiresSTARTTLS(t *testing.T) {
+	server := startSMTP(t, false, false)
+
+	err := sendEmail(context.Background(), server.notifier("starttls"), "hello", Message{})
+	if err == nil || !strings.Contains(err.Error(), "does not support STARTTLS") {
+		t.Errorf("expected STARTTLS error, got %v", err)
+	}
+	if len(server.received()) != 0 {
+		t.Error("expected no message to be sent in plain text")
+	}
+}
+
+func TestSendEmailPlain(t *testing.T) {
+	server := startSMTP(t, false, false)
+	n := server.notifier("none")
+	n.Username, n.Password = "", ""
+
+	if err := sendEmail(context.Background(), n, "hello", Message{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.received(); len(got) != 1 || got[0].TLS || got[0].Auth != "" {
+		t.Errorf("expected one unauthenticated plain-text message, got %+v", got)
+	}
+}
+
+func TestDeliverEmailRetries(t *testing.T) {
+	fastRetries(t)
+	server := startSMTP(t, false, true)
+	server.mu.Lock()
+	server.rcptReplies = []string{"451 4.3.0 try again later"}
+	server.mu.Unlock()
+	d, err := New([]config.Notifier{server.notifier("starttls")}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := deliver(context.Background(), d.targets[0], FromError(errors.New("boom"))); err != nil {
+		t.Fatalf("expected delivery to succeed after a transient error, got %v", err)
+	}
+	if got, conns := len(server.received()), server.connectionCount(); got != 1 || conns != 2 {
+		t.Errorf("expected 1 message after 2 connections, got %d after %d", got, conns)
+	}
+}
+
+func TestDeliverEmailQuitFailure(t *testing.T) {
+	fastRetries(t)
+	server := startSMTP(t, false, true)
+	server.mu.Lock()
+	server.dropOnQuit = true
+	server.mu.Unlock()
+	d, err := New([]config.Notifier{server.notifier("starttls")}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := deliver(context.Background(), d.targets[0], FromError(errors.New("boom"))); err != nil {
+		t.Fatalf("expected delivery to succeed once the message was accepted, got %v", err)
+	}
+	if got, conns := len(server.received()), server.connectionCount(); got != 1 || conns != 1 {
+		t.Errorf("expected 1 message over 1 connection, got %d over %d", got, conns)
+	}
+}
+
+func TestDeliverEmailAuthFailure(t *testing.T) {
+	fastRetries(t)
+	server := startSMTP(t, false, true)
+	n := server.notifier("starttls")
+	n.Password = "wrong"
+	d, err := New([]config.Notifier{n}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = deliver(context.Background(), d.targets[0], FromError(errors.New("boom")))
+	if err == nil || !strings.Contains(err.Error(), "535") {
+		t.Errorf("expected authentication error, got %v", err)
+	}
+	if conns := server.connectionCount(); conns != 1 {
+		t.Errorf("authentication failures should not be retried, got %d connections", conns)
+	}
+}
+
+func TestEmailDigest(t *testing.T) {
+	server := startSMTP(t, false, true)
+	n := server.notifier("starttls")
+	n.FailureThreshold = 2
+	d, err := New([]config.Notifier{n}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	d.Notify(ctx, Message{Status: "success", IPv4: "1.2.3.4", Changes: []Change{
+		{FQDN: "home.example.com", Type: "A", Action: "updated", Old: "5.6.7.8", New: "1.2.3.4"},
+	}})
+	d.Notify(ctx, FromError(errors.New("get IPv4: timeout")))
+	d.Notify(ctx, FromError(errors.New("get IPv4: timeout")))
+	d.Notify(ctx, FromError(errors.New("get IPv4: timeout")))
+
+	got := server.received()
+	if len(got) != 2 {
+		t.Fatalf("expected the change and the second consecutive failure to be sent, got %d messages", len(got))
+	}
+
+	tests := []struct {
+		subject string
+		body    []string
+	}{
+		{"DNS records updated", []string{"- updated A home.example.com: 5.6.7.8 -> 1.2.3.4", "Status: success\nTime: "}},
+		{"cloudflare-ddns run failed", []string{"Run failed: get IPv4: timeout", "Status: total_failure, failed 2 runs in a row"}},
+	}
+	for i, tt := range tests {
+		parsed, err := mail.ReadMessage(strings.NewReader(got[i].Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject")); subject != tt.subject {
+			t.Errorf("message %d: Subject = %q, want %q", i, subject, tt.subject)
+		}
+		body, _ := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+		for _, want := range tt.body {
+			if !strings.Contains(string(body), want) {
+				t.Errorf("message %d: expected %q in digest:\n%s", i, want, body)
+			}
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/oberwager/cloudflare-ddns/internal/cloudflare"
+	"github.com/oberwager/cloudflare-ddns/internal/config"
+	"github.com/oberwager/cloudflare-ddns/internal/metrics"
+	"github.com/oberwager/cloudflare-ddns/internal/retry"
+	"github.com/oberwager/cloudflare-ddns/internal/tracing"
+)
+
+var retryConfig = retry.Config{
+	MaxRetries:  3,
+	InitialWait: 2 * time.Second,
+	MaxWait:     30 * time.Second,
+	OnRetry:     func() { metrics.RetryAttempts.Inc() },
+}
+
+const defaultTemplate = `{{if .Changes}}DNS records changed{{with .IPv4}}, IPv4 {{.}}{{end}}{{with .IPv6}}, IPv6 {{.}}{{end}}:
+{{range .Changes}}- {{.Action}} {{.Type}} {{.FQDN}}{{if and .Old .New (ne .Old .New)}}: {{.Old}} -> {{.New}}{{else if .New}}: {{.New}}{{else if .Old}}: {{.Old}}{{end}}
+{{end}}{{end}}{{with .Error}}Run failed: {{.}}
+{{end}}{{if .Failures}}{{len .Failures}} failed:
+{{range .Failures}}- {{with .Type}}{{.}} {{end}}{{.Name}}: {{.Error}}
+{{end}}{{end}}`
+
+// emailTemplate is a digest of the run, so it also states when the run
+// happened and how long it has been failing.
+const emailTemplate = defaultTemplate + `
+Status: {{.Status}}{{if gt .FailedRuns 1}}, failed {{.FailedRuns}} runs in a row{{end}}
+Time: {{.Time.Format "2006-01-02 15:04:05 MST"}}`
+
+type Change struct {
+	FQDN   string `json:"fqdn"`
+	Type   string `json:"type"`
+	Action string `json:"action"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+}
+
+type Failure struct {
+	Name  string `json:"name"`
+	Type  string `json:"type,omitempty"`
+	Error string `json:"error"`
+}
+
+// Message batches everything worth reporting about one run. It is also the
+// data passed to message templates.
+type Message struct {
+	Time     time.Time `json:"time"`
+	Status   string    `json:"status"`
+	IPv4     string    `json:"ipv4,omitempty"`
+	IPv6     string    `json:"ipv6,omitempty"`
+	Changes  []Change  `json:"changes"`
+	Failures []Failure `json:"failures"`
+	Error    string    `json:"error,omitempty"`
+
+	// FailedRuns counts consecutive failed runs, including this one.
+	FailedRuns int `json:"failed_runs,omitempty"`
+}
+
+var sampleMessage = Message{
+	Time:       time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+	Status:     "partial_failure",
+	IPv4:       "192.0.2.1",
+	IPv6:       "2001:db8::1",
+	Changes:    []Change{{FQDN: "home.example.com", Type: "A", Action: "updated", Old: "192.0.2.2", New: "192.0.2.1"}},
+	Failures:   []Failure{{Name: "vpn.example.com", Type: "A", Error: "HTTP 403"}},
+	FailedRuns: 1,
+}
+
+func FromSummary(summary cloudflare.RunSummary, ips cloudflare.DetectedIPs) Message {
+	m := Message{Time: time.Now(), Status: summary.Status().String(), IPv4: ips.IPv4, IPv6: ips.IPv6}
+	for _, z := range summary.Zones {
+		if z.Err != nil {
+			name := z.Domain
+			if name == "" {
+				name = z.ZoneID
+			}
+			m.Failures = append(m.Failures, Failure{Name: name, Error: z.Err.Error()})
+		}
+
+		for _, r := range z.Records {
+			switch r.Outcome {
+			case cloudflare.Created, cloudflare.Updated, cloudflare.Deleted:
+				c := Change{FQDN: r.FQDN, Type: r.Type, Action: string(r.Outcome)}
+				if r.Old != nil {
+					c.Old = r.Old.Value()
+				}
+				if r.New != nil && r.Outcome != cloudflare.Deleted {
+					c.New = r.New.Value()
+				}
+				m.Changes = append(m.Changes, c)
+			case cloudflare.Failed:
+				f := Failure{Name: r.FQDN, Type: r.Type}
+				if r.Err != nil {
+					f.Error = r.Err.Error()
+				}
+				m.Failures = append(m.Failures, f)
+			}
+		}
+	}
+	return m
+}
+
+// FromError describes a run that failed before any record was processed,
+// e.g. because IP detection failed.
+func FromError(err error) Message {
+	return Message{Time: time.Now(), Status: cloudflare.TotalFailure.String(), Error: err.Error()}
+}
+
+func (m Message) Changed() bool { return len(m.Changes) > 0 }
+func (m Message) Failed() bool  { return m.Error != "" || len(m.Failures) > 0 }
+
+func (m Message) Title() string {
+	switch {
+	case m.Status == cloudflare.TotalFailure.String():
+		return "cloudflare-ddns run failed"
+	case m.Failed():
+		return "cloudflare-ddns completed with failures"
+	default:
+		return "DNS records updated"
+	}
+}
+
+// emailFailureThreshold is the default failure_threshold for email in daemon
+// mode, so a digest goes out when runs fail repeatedly rather than once.
+const emailFailureThreshold = 2
+
+type target struct {
+	cfg       config.Notifier
+	tmpl      *template.Template
+	send      sender
+	threshold int
+}
+
+func (t target) subscribed(event string) bool {
+	return len(t.cfg.Events) == 0 || slices.Contains(t.cfg.Events, event)
+}
+
+// due reports whether msg should go to this notifier. Failures are sent once
+// the run has failed failure_threshold times in a row, and again only when the
+// error changes.
+func (t target) due(msg Message, repeated bool) bool {
+	if msg.Changed() && t.subscribed("change") {
+		return true
+	}
+	if !msg.Failed() || !t.subscribed("failure") {
+		return false
+	}
+	threshold := max(t.threshold, 1)
+	return msg.FailedRuns == threshold || (msg.FailedRuns > threshold && !repeated)
+}
+
+// Dispatcher sends run messages to the configured notifiers.
+type Dispatcher struct {
+	targets []target
+
+	mu          sync.Mutex
+	failedRuns  int
+	lastFailure string
+}
+
+// New builds a dispatcher from the notifier config. Environment variables
+// in the url, token, chat_id, host, username, password and header values are
+// expanded so secrets can stay out of the config file. Failure streaks only
+// live as long as the process, so a failure_threshold above 1 is rejected
+// unless daemon is set.
+func New(cfgs []config.Notifier, daemon bool) (*Dispatcher, error) {
+	d := &Dispatcher{}
+	for i, n := range cfgs {
+		send, ok := senderFor(n.Type)
+		if !ok {
+			return nil, fmt.Errorf("notifications[%d]: unknown type %q", i, n.Type)
+		}
+
+		threshold := n.FailureThreshold
+		switch {
+		case threshold > 1 && !daemon:
+			return nil, fmt.Errorf("notifications[%d]: failure_threshold %d needs daemon mode, one-shot runs don't know about earlier failures", i, threshold)
+		case threshold == 0 && n.Type == "email" && daemon:
+			threshold = emailFailureThreshold
+		}
+
+		n.URL, n.Token, n.ChatID = os.ExpandEnv(n.URL), os.ExpandEnv(n.Token), os.ExpandEnv(n.ChatID)
+		n.Host, n.Username, n.Password = os.ExpandEnv(n.Host), os.ExpandEnv(n.Username), os.ExpandEnv(n.Password)
+		if len(n.Headers) > 0 {
+			headers := make(map[string]string, len(n.Headers))
+			for k, v := range n.Headers {
+				headers[k] = os.ExpandEnv(v)
+			}
+			n.Headers = headers
+		}
+
+		text := n.Template
+		switch {
+		case text != "":
+		case n.Type == "email":
+			text = emailTemplate
+		default:
+			text = defaultTemplate
+		}
+		tmpl, err := template.New(n.Type).Parse(text)
+		if err == nil {
+			// Render sample data so unknown fields fail at startup rather than mid-run.
+			err = tmpl.Execute(io.Discard, sampleMessage)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("notifications[%d]: invalid template: %w", i, err)
+		}
+
+		d.targets = append(d.targets, target{cfg: n, tmpl: tmpl, send: send, threshold: threshold})
+	}
+	return d, nil
+}
+
+// Notify sends msg to every notifier it is due for and waits for delivery.
+// It must be called after every run so failure streaks are tracked. Runs
+// without changes or failures send nothing. Delivery errors are logged rather
+// than returned so they never fail a run.
+func (d *Dispatcher) Notify(ctx context.Context, msg Message) {
+	repeated := d.record(&msg)
+
+	var wg sync.WaitGroup
+	for _, t := range d.targets {
+		if !t.due(msg, repeated) {
+			continue
+		}
+		wg.Add(1)
+		go func(t target) {
+			defer wg.Done()
+			if err := deliver(ctx, t, msg); err != nil {
+				slog.WarnContext(ctx, "failed to send notification", "notifier", t.cfg.Type, "error", err)
+				return
+			}
+			slog.InfoContext(ctx, "sent notification", "notifier", t.cfg.Type, "changes", len(msg.Changes), "failures", len(msg.Failures))
+		}(t)
+	}
+	wg.Wait()
+}
+
+// record updates the failure streak and reports whether msg repeats the
+// previous run's failure.
+func (d *Dispatcher) record(msg *Message) bool {
+	var key string
+	if msg.Failed() {
+		parts := []string{msg.Error}
+		for _, f := range msg.Failures {
+			parts = append(parts, f.Name+" "+f.Type+": "+f.Error)
+		}
+		key = strings.Join(parts, "\n")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if msg.Failed() {
+		d.failedRuns++
+	} else {
+		d.failedRuns = 0
+	}
+	msg.FailedRuns = d.failedRuns
+
+	repeated := key != "" && key == d.lastFailure
+	d.lastFailure = key
+	return repeated
+}
+
+func deliver(ctx context.Context, t target, msg Message) error {
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, msg); err != nil {
+		return fmt.Errorf("render template: %w", err)
+	}
+	text := strings.TrimSpace(b.String())
+
+	ctx, span := tracing.Start(ctx, "notify", tracing.String("notifier", t.cfg.Type))
+	err := retry.WithBackoff(ctx, "send "+t.cfg.Type+" notification", retryConfig, func() error {
+		return t.send(ctx, t.cfg, text, msg)
+	})
+	span.End(err)
+	return err
+}
+
+func send(req *http.Request) error {
+	resp, err := retry.HTTPClient.Do(req)
+	if err != nil {
+		// Webhook URLs and bot tokens are secrets, so keep the URL out of the error.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 300 {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return retry.Retryable(err, retryAfter(resp.Header))
+	}
+	return retry.Permanent(err)
+}
+
+func retryAfter(h http.Header) time.Duration {
+	var secs int
+	if _, err := fmt.Sscan(h.Get("Retry-After"), &secs); err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
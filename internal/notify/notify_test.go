@@ -0,0 +1,281 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oberwager/cloudflare-ddns/internal/cloudflare"
+	"github.com/oberwager/cloudflare-ddns/internal/config"
+	"github.com/oberwager/cloudflare-ddns/internal/retry"
+)
+
+func fastRetries(t *testing.T) {
+	t.Helper()
+	original := retryConfig
+	retryConfig = retry.Config{MaxRetries: 2, InitialWait: time.Millisecond, MaxWait: time.Millisecond}
+	t.Cleanup(func() { retryConfig = original })
+}
+
+type request struct {
+	Path   string
+	Header http.Header
+	Body   string
+}
+
+// receiver records requests and answers with the given status codes in turn,
+// then 200.
+func receiver(t *testing.T, statuses ...int) (*httptest.Server, func() []request) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, request{Path: r.URL.Path, Header: r.Header, Body: string(body)})
+		if n := len(requests); n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []request {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func testSummary() cloudflare.RunSummary {
+	return cloudflare.RunSummary{Zones: []cloudflare.ZoneSummary{
+		{ZoneID: "zone123", Domain: "example.com", Records: []cloudflare.RecordResult{
+			{FQDN: "home.example.com", Type: "A", Outcome: cloudflare.Updated,
+				Old: &cloudflare.Record{Type: "A", Content: "5.6.7.8"}, New: &cloudflare.Record{Type: "A", Content: "1.2.3.4"}},
+			{FQDN: "new.example.com", Type: "A", Outcome: cloudflare.Created, New: &cloudflare.Record{Type: "A", Content: "1.2.3.4"}},
+			{FQDN: "old.example.com", Type: "A", Outcome: cloudflare.Deleted, Old: &cloudflare.Record{Type: "A", Content: "5.6.7.8"}},
+			{FQDN: "www.example.com", Type: "A", Outcome: cloudflare.Unchanged},
+			{FQDN: "vpn.example.com", Type: "AAAA", Outcome: cloudflare.Failed, Err: errors.New("HTTP 403")},
+		}},
+		{ZoneID: "zone456", Err: errors.New("get zone: not found")},
+	}}
+}
+
+func TestFromSummary(t *testing.T) {
+	msg := FromSummary(testSummary(), cloudflare.DetectedIPs{IPv4: "1.2.3.4"})
+
+	if msg.Status != "partial_failure" || msg.IPv4 != "1.2.3.4" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	wantChanges := []Change{
+		{FQDN: "home.example.com", Type: "A", Action: "updated", Old: "5.6.7.8", New: "1.2.3.4"},
+		{FQDN: "new.example.com", Type: "A", Action: "created", New: "1.2.3.4"},
+		{FQDN: "old.example.com", Type: "A", Action: "deleted", Old: "5.6.7.8"},
+	}
+	if len(msg.Changes) != len(wantChanges) {
+		t.Fatalf("changes = %+v, want %+v", msg.Changes, wantChanges)
+	}
+	for i, c := range wantChanges {
+		if msg.Changes[i] != c {
+			t.Errorf("changes[%d] = %+v, want %+v", i, msg.Changes[i], c)
+		}
+	}
+	wantFailures := []Failure{
+		{Name: "vpn.example.com", Type: "AAAA", Error: "HTTP 403"},
+		{Name: "zone456", Error: "get zone: not found"},
+	}
+	if len(msg.Failures) != 2 || msg.Failures[0] != wantFailures[0] || msg.Failures[1] != wantFailures[1] {
+		t.Errorf("failures = %+v, want %+v", msg.Failures, wantFailures)
+	}
+}
+
+func TestDefaultTemplate(t *testing.T) {
+	server, received := receiver(t)
+	d, err := New([]config.Notifier{{Type: "slack", URL: server.URL}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.Notify(context.Background(), FromSummary(testSummary(), cloudflare.DetectedIPs{IPv4: "1.2.3.4"}))
+
+	reqs := received()
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(reqs))
+	}
+	var payload map[string]string
+	json.Unmarshal([]byte(reqs[0].Body), &payload)
+
+	want := `DNS records changed, IPv4 1.2.3.4:
+- updated A home.example.com: 5.6.7.8 -> 1.2.3.4
+- created A new.example.com: 1.2.3.4
+- deleted A old.example.com: 5.6.7.8
+2 failed:
+- AAAA vpn.example.com: HTTP 403
+- zone456: get zone: not found`
+	if payload["text"] != want {
+		t.Errorf("text =\n%s\nwant\n%s", payload["text"], want)
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Setenv("SLACK_URL", "https://hooks.slack.com/services/T/B/X")
+
+	d, err := New([]config.Notifier{{Type: "slack", URL: "${SLACK_URL}", Headers: map[string]string{"X-Auth": "$SLACK_URL"}}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.targets[0].cfg.URL; got != "https://hooks.slack.com/services/T/B/X" {
+		t.Errorf("expected the url to be expanded, got %q", got)
+	}
+	if got := d.targets[0].cfg.Headers["X-Auth"]; got != "https://hooks.slack.com/services/T/B/X" {
+		t.Errorf("expected headers to be expanded, got %q", got)
+	}
+
+	tests := []struct {
+		name   string
+		cfg    config.Notifier
+		errMsg string
+	}{
+		{"syntax error", config.Notifier{Type: "slack", Template: "{{.Changes"}, "notifications[0]: invalid template"},
+		{"unknown field", config.Notifier{Type: "slack", Template: "{{.Hostname}}"}, "can't evaluate field Hostname"},
+		{"unknown type", config.Notifier{Type: "pagerduty"}, `unknown type "pagerduty"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New([]config.Notifier{tt.cfg}, true); err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("expected error containing %q, got %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestNewFailureThreshold(t *testing.T) {
+	if _, err := New([]config.Notifier{{Type: "slack", URL: "https://hooks.slack.com/x", FailureThreshold: 3}}, false); err == nil || !strings.Contains(err.Error(), "needs daemon mode") {
+		t.Errorf("expected failure_threshold to be rejected outside daemon mode, got %v", err)
+	}
+
+	email := config.Notifier{Type: "email", Host: "smtp.example.com", From: "a@example.com", To: []string{"b@example.com"}}
+	tests := []struct {
+		name   string
+		cfg    config.Notifier
+		daemon bool
+		want   int
+	}{
+		{"email in daemon mode", email, true, emailFailureThreshold},
+		{"email in one-shot mode", email, false, 0},
+		{"other notifiers", config.Notifier{Type: "slack", URL: "https://hooks.slack.com/x"}, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := New([]config.Notifier{tt.cfg}, tt.daemon)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := d.targets[0].threshold; got != tt.want {
+				t.Errorf("threshold = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotifyEvents(t *testing.T) {
+	changes, receivedChanges := receiver(t)
+	failures, receivedFailures := receiver(t)
+	d, err := New([]config.Notifier{
+		{Type: "webhook", URL: changes.URL, Events: []string{"change"}},
+		{Type: "webhook", URL: failures.URL, Events: []string{"failure"}},
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	d.Notify(ctx, Message{Status: "success"})
+	d.Notify(ctx, Message{Status: "success", Changes: []Change{{FQDN: "home.example.com", Action: "updated"}}})
+	d.Notify(ctx, FromError(errors.New("get IPv4: timeout")))
+
+	if got := len(receivedChanges()); got != 1 {
+		t.Errorf("change notifier got %d requests, want 1", got)
+	}
+	if got := len(receivedFailures()); got != 1 {
+		t.Errorf("failure notifier got %d requests, want 1", got)
+	}
+}
+
+func TestNotifyRepeatedFailure(t *testing.T) {
+	server, received := receiver(t)
+	d, err := New([]config.Notifier{{Type: "webhook", URL: server.URL}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	d.Notify(ctx, FromError(errors.New("get IPv4: timeout")))
+	d.Notify(ctx, FromError(errors.New("get IPv4: timeout")))
+	if got := len(received()); got != 1 {
+		t.Fatalf("expected the repeated failure to be suppressed, got %d requests", got)
+	}
+
+	d.Notify(ctx, FromError(errors.New("get IPv4: no route to host")))
+	d.Notify(ctx, Message{Status: "success"})
+	d.Notify(ctx, FromError(errors.New("get IPv4: no route to host")))
+	if got := len(received()); got != 3 {
+		t.Errorf("expected new and recurring failures to be sent, got %d requests", got)
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	fastRetries(t)
+	server, received := receiver(t, http.StatusTooManyRequests, http.StatusBadGateway)
+	d, err := New([]config.Notifier{{Type: "discord", URL: server.URL}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := deliver(context.Background(), d.targets[0], FromError(errors.New("boom"))); err != nil {
+		t.Fatalf("expected delivery to succeed after retries, got %v", err)
+	}
+	if got := len(received()); got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+}
+
+func TestDeliverPermanentError(t *testing.T) {
+	fastRetries(t)
+	server, received := receiver(t, http.StatusNotFound)
+	d, err := New([]config.Notifier{{Type: "telegram", URL: server.URL, Token: "123:secret", ChatID: "42"}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = deliver(context.Background(), d.targets[0], FromError(errors.New("boom")))
+	if err == nil || !strings.Contains(err.Error(), "HTTP 404") {
+		t.Errorf("expected HTTP 404 error, got %v", err)
+	}
+	if got := len(received()); got != 1 {
+		t.Errorf("client errors should not be retried, got %d attempts", got)
+	}
+}
+
+func TestDeliverHidesURL(t *testing.T) {
+	fastRetries(t)
+	server, _ := receiver(t)
+	server.Close()
+	d, err := New([]config.Notifier{{Type: "telegram", URL: server.URL, Token: "123:secret", ChatID: "42"}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = deliver(context.Background(), d.targets[0], FromError(errors.New("boom")))
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("expected an error without the bot token, got %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/oberwager/cloudflare-ddns/internal/config"
+	"github.com/oberwager/cloudflare-ddns/internal/retry"
+)
+
+const telegramAPI = "https://api.telegram.org"
+
+// sender delivers a rendered message. It's called once per delivery attempt.
+type sender func(ctx context.Context, n config.Notifier, text string, msg Message) error
+
+// requestBuilder turns a rendered message into the request an HTTP service
+// expects.
+type requestBuilder func(ctx context.Context, n config.Notifier, text string, msg Message) (*http.Request, error)
+
+var builders = map[string]requestBuilder{
+	"webhook":  webhookRequest,
+	"slack":    slackRequest,
+	"discord":  discordRequest,
+	"telegram": telegramRequest,
+	"ntfy":     ntfyRequest,
+	"gotify":   gotifyRequest,
+}
+
+func senderFor(typ string) (sender, bool) {
+	if typ == "email" {
+		return sendEmail, true
+	}
+	build, ok := builders[typ]
+	if !ok {
+		return nil, false
+	}
+	return func(ctx context.Context, n config.Notifier, text string, msg Message) error {
+		req, err := build(ctx, n, text, msg)
+		if err != nil {
+			return retry.Permanent(err)
+		}
+		for k, v := range n.Headers {
+			req.Header.Set(k, v)
+		}
+		return send(req)
+	}, true
+}
+
+// webhookRequest posts the whole message as JSON, with the rendered text
+// under "text".
+func webhookRequest(ctx context.Context, n config.Notifier, text string, msg Message) (*http.Request, error) {
+	return jsonRequest(ctx, n.URL, struct {
+		Text string `json:"text"`
+		Message
+	}{text, msg})
+}
+
+func slackRequest(ctx context.Context, n config.Notifier, text string, _ Message) (*http.Request, error) {
+	return jsonRequest(ctx, n.URL, map[string]string{"text": text})
+}
+
+func discordRequest(ctx context.Context, n config.Notifier, text string, _ Message) (*http.Request, error) {
+	return jsonRequest(ctx, n.URL, map[string]string{"content": truncate(text, 2000)})
+}
+
+func telegramRequest(ctx context.Context, n config.Notifier, text string, _ Message) (*http.Request, error) {
+	base := n.URL
+	if base == "" {
+		base = telegramAPI
+	}
+	return jsonRequest(ctx, strings.TrimSuffix(base, "/")+"/bot"+n.Token+"/sendMessage", map[string]string{
+		"chat_id": n.ChatID,
+		"text":    truncate(text, 4096),
+	})
+}
+
+// ntfyRequest publishes to the topic in the URL, e.g. https://ntfy.sh/my-home.
+func ntfyRequest(ctx context.Context, n config.Notifier, text string, msg Message) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, strings.NewReader(text))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Title", msg.Title())
+	if msg.Failed() {
+		req.Header.Set("Priority", "high")
+		req.Header.Set("Tags", "warning")
+	} else {
+		req.Header.Set("Tags", "globe_with_meridians")
+	}
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+	return req, nil
+}
+
+func gotifyRequest(ctx context.Context, n config.Notifier, text string, msg Message) (*http.Request, error) {
+	priority := 5
+	if msg.Failed() {
+		priority = 8
+	}
+	req, err := jsonRequest(ctx, strings.TrimSuffix(n.URL, "/")+"/message", map[string]any{
+		"title":    msg.Title(),
+		"message":  text,
+		"priority": priority,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Gotify-Key", n.Token)
+	return req, nil
+}
+
+func jsonRequest(ctx context.Context, url string, payload any) (*http.Request, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshal payload: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
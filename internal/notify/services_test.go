@@ -0,0 +1,125 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/oberwager/cloudflare-ddns/internal/config"
+)
+
+func TestServices(t *testing.T) {
+	server, _ := receiver(t)
+	failure := Message{Status: "total_failure", Error: "get IPv4: timeout"}
+	change := Message{Status: "success", Changes: []Change{{FQDN: "home.example.com", Type: "A", Action: "updated"}}}
+
+	tests := []struct {
+		name       string
+		cfg        config.Notifier
+		msg        Message
+		wantPath   string
+		wantHeader map[string]string
+		wantBody   string
+	}{
+		{
+			name:       "webhook",
+			cfg:        config.Notifier{Type: "webhook", URL: server.URL + "/hook"},
+			msg:        failure,
+			wantPath:   "/hook",
+			wantHeader: map[string]string{"Content-Type": "application/json"},
+			wantBody:   `{"text":"hello","time":"0001-01-01T00:00:00Z","status":"total_failure","changes":null,"failures":null,"error":"get IPv4: timeout"}`,
+		},
+		{
+			name:     "slack",
+			cfg:      config.Notifier{Type: "slack", URL: server.URL + "/services/T/B/X"},
+			msg:      change,
+			wantPath: "/services/T/B/X",
+			wantBody: `{"text":"hello"}`,
+		},
+		{
+			name:     "discord",
+			cfg:      config.Notifier{Type: "discord", URL: server.URL + "/api/webhooks/1/abc"},
+			msg:      change,
+			wantPath: "/api/webhooks/1/abc",
+			wantBody: `{"content":"hello"}`,
+		},
+		{
+			name:     "telegram",
+			cfg:      config.Notifier{Type: "telegram", URL: server.URL, Token: "123:abc", ChatID: "-100"},
+			msg:      change,
+			wantPath: "/bot123:abc/sendMessage",
+			wantBody: `{"chat_id":"-100","text":"hello"}`,
+		},
+		{
+			name:       "ntfy failure",
+			cfg:        config.Notifier{Type: "ntfy", URL: server.URL + "/home", Token: "tk_abc"},
+			msg:        failure,
+			wantPath:   "/home",
+			wantHeader: map[string]string{"Title": "cloudflare-ddns run failed", "Priority": "high", "Tags": "warning", "Authorization": "Bearer tk_abc"},
+			wantBody:   "hello",
+		},
+		{
+			name:       "ntfy change",
+			cfg:        config.Notifier{Type: "ntfy", URL: server.URL + "/home"},
+			msg:        change,
+			wantPath:   "/home",
+			wantHeader: map[string]string{"Title": "DNS records updated", "Priority": "", "Authorization": ""},
+			wantBody:   "hello",
+		},
+		{
+			name:       "gotify",
+			cfg:        config.Notifier{Type: "gotify", URL: server.URL + "/", Token: "app-token"},
+			msg:        failure,
+			wantPath:   "/message",
+			wantHeader: map[string]string{"X-Gotify-Key": "app-token"},
+			wantBody:   `{"message":"hello","priority":8,"title":"cloudflare-ddns run failed"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := builders[tt.cfg.Type](context.Background(), tt.cfg, "hello", tt.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if req.Method != "POST" || req.URL.Path != tt.wantPath {
+				t.Errorf("request = %s %s, want POST %s", req.Method, req.URL.Path, tt.wantPath)
+			}
+			for k, v := range tt.wantHeader {
+				if got := req.Header.Get(k); got != v {
+					t.Errorf("header %s = %q, want %q", k, got, v)
+				}
+			}
+
+			body, _ := io.ReadAll(req.Body)
+			got := string(body)
+			if strings.HasPrefix(tt.wantBody, "{") {
+				// Compare JSON independent of key order.
+				var gotJSON, wantJSON any
+				json.Unmarshal([]byte(got), &gotJSON)
+				json.Unmarshal([]byte(tt.wantBody), &wantJSON)
+				g, _ := json.Marshal(gotJSON)
+				w, _ := json.Marshal(wantJSON)
+				got, tt.wantBody = string(g), string(w)
+			}
+			if got != tt.wantBody {
+				t.Errorf("body = %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("short", 10); got != "short" {
+		t.Errorf("truncate() = %q, want unchanged", got)
+	}
+
+	got := truncate(strings.Repeat("é", 3000), 2000)
+	if n := utf8.RuneCountInString(got); n != 2000 || !strings.HasSuffix(got, "…") || !utf8.ValidString(got) {
+		t.Errorf("expected 2000 valid runes ending in an ellipsis, got %d", n)
+	}
+}
@@ -2,6 +2,7 @@ package retry
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math"
@@ -28,6 +29,9 @@ type Config struct {
 	MaxRetries  int
 	InitialWait time.Duration
 	MaxWait     time.Duration
+
+	// OnRetry, if set, is called before every retry, e.g. to count it.
+	OnRetry func()
 }
 
 func DefaultConfig() Config {
@@ -40,11 +44,38 @@ func DefaultConfig() Config {
 
 type Func func() error
 
+type RetryableError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryableError) Error() string { return e.Err.Error() }
+func (e *RetryableError) Unwrap() error { return e.Err }
+
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+func Retryable(err error, retryAfter time.Duration) error {
+	return &RetryableError{Err: err, RetryAfter: retryAfter}
+}
+
+func Permanent(err error) error {
+	return &PermanentError{Err: err}
+}
+
 func WithBackoff(ctx context.Context, operation string, config Config, fn Func) error {
 	var lastErr error
+	var retryAfter time.Duration
 
 	for attempt := 0; attempt <= config.MaxRetries; attempt++ {
 		if attempt > 0 {
+			if config.OnRetry != nil {
+				config.OnRetry()
+			}
 			backoff := time.Duration(math.Pow(2, float64(attempt-1))) * config.InitialWait
 			if backoff > config.MaxWait {
 				backoff = config.MaxWait
@@ -57,7 +88,12 @@ func WithBackoff(ctx context.Context, operation string, config Config, fn Func)
 				backoff -= jitter
 			}
 
-			slog.Warn("retrying operation",
+			// A server asking for a long pause still can't stall a run past MaxWait.
+			if retryAfter > backoff {
+				backoff = min(retryAfter, config.MaxWait)
+			}
+
+			slog.WarnContext(ctx, "retrying operation",
 				"operation", operation,
 				"attempt", attempt,
 				"max_attempts", config.MaxRetries,
@@ -82,11 +118,17 @@ func WithBackoff(ctx context.Context, operation string, config Config, fn Func)
 				return fmt.Errorf("%s: non-retryable error: %w", operation, err)
 			}
 
+			retryAfter = 0
+			var retryable *RetryableError
+			if errors.As(err, &retryable) {
+				retryAfter = retryable.RetryAfter
+			}
+
 			continue
 		}
 
 		if attempt > 0 {
-			slog.Info("operation succeeded after retry",
+			slog.InfoContext(ctx, "operation succeeded after retry",
 				"operation", operation,
 				"attempts", attempt+1)
 		}
@@ -97,6 +139,16 @@ func WithBackoff(ctx context.Context, operation string, config Config, fn Func)
 }
 
 func isRetryableError(err error) bool {
+	var permanent *PermanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+
+	var retryable *RetryableError
+	if errors.As(err, &retryable) {
+		return true
+	}
+
 	if netErr, ok := err.(net.Error); ok {
 		return netErr.Timeout() || netErr.Temporary()
 	}
@@ -3,6 +3,7 @@ package retry
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"testing"
 	"time"
@@ -143,6 +144,114 @@ func TestRetryWithBackoffNonRetryableError(t *testing.T) {
 	}
 }
 
+func TestRetryWithBackoffHonoursRetryAfter(t *testing.T) {
+	ctx := context.Background()
+	cfg := Config{
+		MaxRetries:  1,
+		InitialWait: 1 * time.Millisecond,
+		MaxWait:     time.Second,
+	}
+
+	callCount := 0
+	fn := func() error {
+		callCount++
+		if callCount == 1 {
+			return Retryable(errors.New("HTTP 429: rate limited"), 50*time.Millisecond)
+		}
+		return nil
+	}
+
+	start := time.Now()
+	err := WithBackoff(ctx, "test", cfg, fn)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected to wait at least 50ms for Retry-After, waited %v", elapsed)
+	}
+	if callCount != 2 {
+		t.Errorf("expected 2 calls, got %d", callCount)
+	}
+}
+
+func TestRetryWithBackoffCapsRetryAfter(t *testing.T) {
+	ctx := context.Background()
+	cfg := Config{
+		MaxRetries:  1,
+		InitialWait: 1 * time.Millisecond,
+		MaxWait:     10 * time.Millisecond,
+	}
+
+	callCount := 0
+	fn := func() error {
+		callCount++
+		if callCount == 1 {
+			return Retryable(errors.New("HTTP 429: rate limited"), 24*time.Hour)
+		}
+		return nil
+	}
+
+	start := time.Now()
+	if err := WithBackoff(ctx, "test", cfg, fn); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected Retry-After to be capped at MaxWait, waited %v", elapsed)
+	}
+}
+
+func TestRetryWithBackoffOnRetry(t *testing.T) {
+	retries := 0
+	cfg := Config{
+		MaxRetries:  3,
+		InitialWait: 1 * time.Millisecond,
+		MaxWait:     1 * time.Millisecond,
+		OnRetry:     func() { retries++ },
+	}
+
+	callCount := 0
+	err := WithBackoff(context.Background(), "test", cfg, func() error {
+		callCount++
+		if callCount < 3 {
+			return Retryable(errors.New("HTTP 502"), 0)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if retries != 2 {
+		t.Errorf("expected OnRetry to be called 2 times, got %d", retries)
+	}
+}
+
+func TestRetryWithBackoffPermanentError(t *testing.T) {
+	ctx := context.Background()
+	cfg := Config{
+		MaxRetries:  3,
+		InitialWait: 1 * time.Millisecond,
+		MaxWait:     10 * time.Millisecond,
+	}
+
+	callCount := 0
+	fn := func() error {
+		callCount++
+		return Permanent(errors.New("HTTP 403: request timeout while authenticating"))
+	}
+
+	err := WithBackoff(ctx, "test", cfg, fn)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	var permanent *PermanentError
+	if !errors.As(err, &permanent) {
+		t.Errorf("expected PermanentError in chain, got %v", err)
+	}
+	if callCount != 1 {
+		t.Errorf("expected 1 call, got %d", callCount)
+	}
+}
+
 func TestIsRetryableError(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -194,6 +303,21 @@ func TestIsRetryableError(t *testing.T) {
 			err:       errors.New("invalid input"),
 			retryable: false,
 		},
+		{
+			name:      "explicitly retryable",
+			err:       Retryable(errors.New("HTTP 503"), 0),
+			retryable: true,
+		},
+		{
+			name:      "wrapped retryable",
+			err:       fmt.Errorf("list records: %w", Retryable(errors.New("HTTP 429"), time.Second)),
+			retryable: true,
+		},
+		{
+			name:      "permanent overrides message pattern",
+			err:       Permanent(errors.New("connection refused by policy")),
+			retryable: false,
+		},
 	}
 
 	for _, tt := range tests {
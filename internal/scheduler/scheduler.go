@@ -0,0 +1,35 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+type Func func(ctx context.Context) error
+
+func Run(ctx context.Context, interval time.Duration, fn Func) error {
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive, got %s", interval)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err := fn(ctx); err != nil {
+			slog.Error("scheduled run failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunInvalidInterval(t *testing.T) {
+	err := Run(context.Background(), 0, func(ctx context.Context) error { return nil })
+	if err == nil {
+		t.Fatal("expected error for zero interval, got nil")
+	}
+}
+
+func TestRunUntilCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	callCount := 0
+	fn := func(ctx context.Context) error {
+		callCount++
+		if callCount == 3 {
+			cancel()
+		}
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- Run(ctx, time.Millisecond, fn) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+
+	if callCount != 3 {
+		t.Errorf("expected 3 calls, got %d", callCount)
+	}
+}
+
+func TestRunContinuesAfterError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	callCount := 0
+	fn := func(ctx context.Context) error {
+		callCount++
+		if callCount == 2 {
+			cancel()
+		}
+		return errors.New("run failed")
+	}
+
+	if err := Run(ctx, time.Millisecond, fn); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if callCount != 2 {
+		t.Errorf("expected 2 calls, got %d", callCount)
+	}
+}
+
+func TestRunAlreadyCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	callCount := 0
+	fn := func(ctx context.Context) error {
+		callCount++
+		return nil
+	}
+
+	if err := Run(ctx, time.Millisecond, fn); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if callCount != 0 {
+		t.Errorf("expected 0 calls, got %d", callCount)
+	}
+}
@@ -0,0 +1,416 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Spans are exported as OTLP/HTTP JSON, which any OpenTelemetry collector
+// accepts, without pulling in the OpenTelemetry SDK.
+
+type Attr struct {
+	Key   string
+	Value any
+}
+
+func String(key, value string) Attr    { return Attr{key, value} }
+func Int(key string, value int) Attr   { return Attr{key, value} }
+func Bool(key string, value bool) Attr { return Attr{key, value} }
+
+// Span kinds and status codes from the OTLP protobuf enums.
+const (
+	kindInternal = 1
+	kindClient   = 3
+
+	statusError = 2
+)
+
+type Span struct {
+	traceID [16]byte
+	spanID  [8]byte
+	parent  [8]byte
+	name    string
+	kind    int
+	start   time.Time
+
+	mu    sync.Mutex
+	attrs []Attr
+	ended bool
+}
+
+type spanKey struct{}
+
+// Start begins a span as a child of the span in ctx. It returns a nil span,
+// which is safe to use, when tracing isn't configured.
+func Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	return start(ctx, name, kindInternal, attrs)
+}
+
+// StartClient begins a span for an outbound call, such as an API request.
+func StartClient(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	return start(ctx, name, kindClient, attrs)
+}
+
+func start(ctx context.Context, name string, kind int, attrs []Attr) (context.Context, *Span) {
+	if current() == nil {
+		return ctx, nil
+	}
+
+	s := &Span{name: name, kind: kind, start: time.Now(), attrs: attrs}
+	if parent := FromContext(ctx); parent != nil {
+		s.traceID, s.parent = parent.traceID, parent.spanID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+func (s *Span) SpanID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.spanID[:])
+}
+
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// End finishes the span, marking it failed when err is non-nil, and queues it
+// for export. Successful spans keep the unset status, which instrumentation
+// is meant to leave to the application. Calls after the first are ignored.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	span := otlpSpan{
+		TraceID:   hex.EncodeToString(s.traceID[:]),
+		SpanID:    hex.EncodeToString(s.spanID[:]),
+		Name:      s.name,
+		Kind:      s.kind,
+		StartTime: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTime:   strconv.FormatInt(time.Now().UnixNano(), 10),
+		Attrs:     encodeAttrs(s.attrs),
+	}
+	s.mu.Unlock()
+
+	if s.parent != [8]byte{} {
+		span.ParentID = hex.EncodeToString(s.parent[:])
+	}
+	if err != nil {
+		span.Status = otlpStatus{Code: statusError, Message: err.Error()}
+	}
+
+	if exp := current(); exp != nil {
+		exp.add(span)
+	}
+}
+
+type Config struct {
+	// Endpoint is the full OTLP/HTTP traces URL, e.g. http://localhost:4318/v1/traces.
+	Endpoint      string
+	ServiceName   string
+	Headers       map[string]string
+	BatchSize     int
+	FlushInterval time.Duration
+	Client        *http.Client
+}
+
+// ConfigFromEnv reads the standard OTEL_* variables. ok is false when no
+// endpoint is set and tracing should stay disabled.
+func ConfigFromEnv() (cfg Config, ok bool) {
+	cfg.Endpoint = os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if cfg.Endpoint == "" {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			return cfg, false
+		}
+		cfg.Endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+
+	cfg.ServiceName = os.Getenv("OTEL_SERVICE_NAME")
+	if raw := os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"); raw != "" {
+		cfg.Headers = make(map[string]string)
+		for _, pair := range strings.Split(raw, ",") {
+			if k, v, found := strings.Cut(pair, "="); found {
+				cfg.Headers[unescape(strings.TrimSpace(k))] = unescape(strings.TrimSpace(v))
+			}
+		}
+	}
+	return cfg, true
+}
+
+// unescape decodes the percent-encoding the spec uses for header keys and
+// values, keeping the raw text if it isn't valid.
+func unescape(s string) string {
+	if decoded, err := url.PathUnescape(s); err == nil {
+		return decoded
+	}
+	return s
+}
+
+type exporter struct {
+	cfg   Config
+	mu    sync.Mutex
+	queue []otlpSpan
+	kick  chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+var (
+	globalMu sync.RWMutex
+	global   *exporter
+)
+
+func current() *exporter {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+	return global
+}
+
+// Setup enables tracing and starts exporting spans in the background.
+func Setup(cfg Config) {
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "cloudflare-ddns"
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 256
+	}
+	if cfg.FlushInterval == 0 {
+		cfg.FlushInterval = 5 * time.Second
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	exp := &exporter{cfg: cfg, kick: make(chan struct{}, 1), stop: make(chan struct{}), done: make(chan struct{})}
+	go exp.loop()
+
+	globalMu.Lock()
+	global = exp
+	globalMu.Unlock()
+}
+
+// Shutdown flushes queued spans and disables tracing.
+func Shutdown(ctx context.Context) {
+	globalMu.Lock()
+	exp := global
+	global = nil
+	globalMu.Unlock()
+
+	if exp == nil {
+		return
+	}
+	close(exp.stop)
+	select {
+	case <-exp.done:
+	case <-ctx.Done():
+	}
+}
+
+func (e *exporter) add(span otlpSpan) {
+	e.mu.Lock()
+	e.queue = append(e.queue, span)
+	full := len(e.queue) >= e.cfg.BatchSize
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (e *exporter) loop() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stop:
+			e.flush()
+			return
+		case <-ticker.C:
+		case <-e.kick:
+		}
+		e.flush()
+	}
+}
+
+func (e *exporter) flush() {
+	e.mu.Lock()
+	spans := e.queue
+	e.queue = nil
+	e.mu.Unlock()
+
+	if len(spans) == 0 {
+		return
+	}
+	if err := e.export(spans); err != nil {
+		slog.Warn("failed to export traces", "endpoint", e.cfg.Endpoint, "spans", len(spans), "error", err)
+	}
+}
+
+func (e *exporter) export(spans []otlpSpan) error {
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attrs: encodeAttrs([]Attr{String("service.name", e.cfg.ServiceName)})},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/oberwager/cloudflare-ddns"},
+			Spans: spans,
+		}},
+	}}})
+	if err != nil {
+		return fmt.Errorf("marshal spans: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.cfg.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// Handler adds the trace and span IDs of the span in the record's context to
+// every log record.
+type Handler struct {
+	slog.Handler
+}
+
+func NewHandler(h slog.Handler) *Handler {
+	return &Handler{h}
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	if s := FromContext(ctx); s != nil {
+		r.AddAttrs(slog.String("trace_id", s.TraceID()), slog.String("span_id", s.SpanID()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Handler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{h.Handler.WithGroup(name)}
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attrs []otlpAttr `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID   string     `json:"traceId"`
+	SpanID    string     `json:"spanId"`
+	ParentID  string     `json:"parentSpanId,omitempty"`
+	Name      string     `json:"name"`
+	Kind      int        `json:"kind"`
+	StartTime string     `json:"startTimeUnixNano"`
+	EndTime   string     `json:"endTimeUnixNano"`
+	Attrs     []otlpAttr `json:"attributes,omitempty"`
+	Status    otlpStatus `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func encodeAttrs(attrs []Attr) []otlpAttr {
+	out := make([]otlpAttr, 0, len(attrs))
+	for _, a := range attrs {
+		var v map[string]any
+		switch val := a.Value.(type) {
+		case string:
+			v = map[string]any{"stringValue": val}
+		case int:
+			// OTLP JSON encodes 64-bit integers as strings.
+			v = map[string]any{"intValue": strconv.Itoa(val)}
+		case bool:
+			v = map[string]any{"boolValue": val}
+		default:
+			v = map[string]any{"stringValue": fmt.Sprint(val)}
+		}
+		out = append(out, otlpAttr{Key: a.Key, Value: v})
+	}
+	return out
+}
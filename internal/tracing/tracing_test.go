@@ -0,0 +1,197 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector records the spans posted to it.
+func collector(t *testing.T) (*httptest.Server, func() []otlpSpan) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var spans []otlpSpan
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []otlpSpan {
+		mu.Lock()
+		defer mu.Unlock()
+		return spans
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	ctx, span := Start(context.Background(), "run")
+	if span != nil || FromContext(ctx) != nil {
+		t.Fatal("expected no span when tracing is not set up")
+	}
+	// A nil span must be safe to use.
+	span.SetAttributes(String("k", "v"))
+	span.End(errors.New("boom"))
+	if span.TraceID() != "" {
+		t.Error("expected empty trace ID")
+	}
+}
+
+func TestExport(t *testing.T) {
+	server, received := collector(t)
+	Setup(Config{Endpoint: server.URL + "/v1/traces", FlushInterval: time.Hour})
+
+	ctx, parent := Start(context.Background(), "run", String("mode", "once"))
+	_, child := StartClient(ctx, "cfAPI GET", Int("retry.attempt", 1))
+	child.SetAttributes(Bool("dry_run", true))
+	child.End(errors.New("HTTP 500"))
+	parent.End(nil)
+	parent.End(errors.New("ignored"))
+
+	Shutdown(context.Background())
+
+	spans := received()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d: %+v", len(spans), spans)
+	}
+	c, p := spans[0], spans[1]
+
+	if c.TraceID != p.TraceID || len(c.TraceID) != 32 {
+		t.Errorf("expected a shared 16-byte trace ID, got %q and %q", c.TraceID, p.TraceID)
+	}
+	if c.ParentID != p.SpanID || p.ParentID != "" {
+		t.Errorf("unexpected parent IDs: child %q, parent %q, parent span %q", c.ParentID, p.ParentID, p.SpanID)
+	}
+	if c.Status.Code != statusError || c.Status.Message != "HTTP 500" || p.Status.Code != 0 {
+		t.Errorf("unexpected statuses: child %+v, parent %+v", c.Status, p.Status)
+	}
+	if c.Kind != kindClient || p.Kind != kindInternal {
+		t.Errorf("unexpected kinds: child %d, parent %d", c.Kind, p.Kind)
+	}
+
+	attrs, _ := json.Marshal(c.Attrs)
+	want := `[{"key":"retry.attempt","value":{"intValue":"1"}},{"key":"dry_run","value":{"boolValue":true}}]`
+	if string(attrs) != want {
+		t.Errorf("attributes = %s, want %s", attrs, want)
+	}
+
+	if _, span := Start(context.Background(), "after shutdown"); span != nil {
+		t.Error("expected tracing to be disabled after Shutdown")
+	}
+}
+
+func TestExportBatchSize(t *testing.T) {
+	server, received := collector(t)
+	Setup(Config{Endpoint: server.URL + "/v1/traces", BatchSize: 2, FlushInterval: time.Hour})
+	defer Shutdown(context.Background())
+
+	for range 2 {
+		_, span := Start(context.Background(), "upsertRecord")
+		span.End(nil)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(received()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := len(received()); got != 2 {
+		t.Errorf("expected a full batch to be exported before the flush interval, got %d spans", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	server, _ := collector(t)
+	Setup(Config{Endpoint: server.URL + "/v1/traces", FlushInterval: time.Hour})
+	defer Shutdown(context.Background())
+
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(slog.NewJSONHandler(&buf, nil))).With("component", "test")
+
+	ctx, span := Start(context.Background(), "run")
+	logger.InfoContext(ctx, "inside span")
+	logger.Info("outside span")
+	span.End(nil)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log lines, got %q", buf.String())
+	}
+
+	var inside, outside map[string]any
+	json.Unmarshal([]byte(lines[0]), &inside)
+	json.Unmarshal([]byte(lines[1]), &outside)
+	if inside["trace_id"] != span.TraceID() || inside["span_id"] != span.SpanID() || inside["component"] != "test" {
+		t.Errorf("expected trace IDs on the record, got %v", inside)
+	}
+	if _, ok := outside["trace_id"]; ok {
+		t.Errorf("expected no trace ID without a span, got %v", outside)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          map[string]string
+		wantOK       bool
+		wantEndpoint string
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:         "base endpoint",
+			env:          map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318/"},
+			wantOK:       true,
+			wantEndpoint: "http://collector:4318/v1/traces",
+		},
+		{
+			name: "traces endpoint wins",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT":        "http://collector:4318",
+				"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://tempo:4318/v1/traces",
+			},
+			wantOK:       true,
+			wantEndpoint: "http://tempo:4318/v1/traces",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_HEADERS"} {
+				t.Setenv(key, tt.env[key])
+			}
+			t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "authorization=Bearer%20abc, x-tenant=home")
+
+			cfg, ok := ConfigFromEnv()
+			if ok != tt.wantOK || cfg.Endpoint != tt.wantEndpoint {
+				t.Errorf("ConfigFromEnv() = %q, %v, want %q, %v", cfg.Endpoint, ok, tt.wantEndpoint, tt.wantOK)
+			}
+			if ok && (cfg.Headers["authorization"] != "Bearer abc" || cfg.Headers["x-tenant"] != "home") {
+				t.Errorf("unexpected headers: %v", cfg.Headers)
+			}
+		})
+	}
+}
@@ -2,32 +2,76 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/oberwager/cloudflare-ddns/internal/cloudflare"
 	"github.com/oberwager/cloudflare-ddns/internal/config"
+	"github.com/oberwager/cloudflare-ddns/internal/health"
 	"github.com/oberwager/cloudflare-ddns/internal/ip"
+	"github.com/oberwager/cloudflare-ddns/internal/metrics"
+	"github.com/oberwager/cloudflare-ddns/internal/notify"
+	"github.com/oberwager/cloudflare-ddns/internal/retry"
+	"github.com/oberwager/cloudflare-ddns/internal/scheduler"
+	"github.com/oberwager/cloudflare-ddns/internal/tracing"
 )
 
 var Version = "dev"
 
+const defaultInterval = 5 * time.Minute
+
+// tokenCheckInterval spaces out token verification for /readyz, which would
+// otherwise add an API call to every run, including skipped ones.
+const tokenCheckInterval = time.Hour
+
+const (
+	exitFatal          = 1
+	exitPartialFailure = 2
+	exitTotalFailure   = 3
+	exitChangesPending = 4
+)
+
 func main() {
-	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+	daemon := flag.Bool("daemon", false, "keep running and re-check the public IP every CF_INTERVAL (default 5m)")
+	dryRun := flag.Bool("dry-run", false, "detect IPs and list records, then print the planned changes without applying them")
+	configPath := flag.String("config", "", "path to a JSON, YAML or TOML config file (overrides CF_CONFIG_FILE and CF_CONFIG)")
+	planFormat := flag.String("plan-format", "text", "output format for --dry-run: text or json")
+	flag.Parse()
+
+	// In dry-run the plan owns stdout so it can be piped or diffed.
+	logOutput := os.Stdout
+	if *dryRun {
+		logOutput = os.Stderr
+	}
+	slog.SetDefault(slog.New(tracing.NewHandler(slog.NewJSONHandler(logOutput, nil))))
 	slog.Info("starting cloudflare-ddns", "version", Version)
 
+	if tcfg, ok := tracing.ConfigFromEnv(); ok {
+		tracing.Setup(tcfg)
+		defer flushTraces()
+		slog.Info("exporting traces", "endpoint", tcfg.Endpoint)
+	}
+
 	token := mustEnv("CF_API_TOKEN")
-	configJSON := mustEnv("CF_CONFIG")
 	ipv6Enabled := os.Getenv("CF_IPV6_ENABLED") == "true"
 
-	var cfg config.Config
-	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
-		fatal("parse config", err)
+	interval, err := parseInterval(os.Getenv("CF_INTERVAL"))
+	if err != nil {
+		fatal("parse CF_INTERVAL", err)
 	}
 
-	if err := config.Validate(&cfg); err != nil {
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
 		fatal("invalid config", err)
 	}
 
@@ -39,48 +83,508 @@ func main() {
 		cfg.ConcurrencyLimit = 10
 	}
 
-	ctx := context.Background()
+	if *planFormat != "text" && *planFormat != "json" {
+		fatal("parse flags", fmt.Errorf("unknown plan format: %q", *planFormat))
+	}
+
+	opts := cloudflare.Options{
+		DefaultTTL:       cfg.DefaultTTL,
+		ConcurrencyLimit: cfg.ConcurrencyLimit,
+		DryRun:           *dryRun,
+		Duplicates:       cfg.DuplicatePolicy,
+	}
+	if cfg.ManagedComment {
+		opts.DefaultComment = cloudflare.ManagedComment
+	}
+	if cfg.OwnerID != "" || cfg.Prune {
+		opts.Owner, opts.Prune = cfg.OwnerID, cfg.Prune
+		if opts.Owner == "" {
+			opts.Owner = "default"
+		}
+	}
+
+	ips, err := newDetector(cfg, ipv6Enabled)
+	if err != nil {
+		fatal("invalid config", err)
+	}
+
+	notifier, err := notify.New(cfg.Notifications, *daemon || interval != 0)
+	if err != nil {
+		fatal("invalid config", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// One-shot runs have nothing to fall back on, so an unresolved zone is
+	// fatal. The daemon resolves zones in its first successful run instead.
+	if *dryRun || (!*daemon && interval == 0) {
+		zones, err := resolveZones(ctx, token, cfg)
+		if err != nil {
+			fatal("resolve zones", err)
+		}
+		cfg.Zones = zones
+	}
+
+	if *dryRun {
+		runCtx, span := tracing.Start(ctx, "run", tracing.String("mode", "dry-run"))
+		detected, err := ips.detect(runCtx)
+		if err != nil {
+			span.End(err)
+			fatal("get IPv4", err)
+		}
+		summary := processZones(runCtx, token, cfg, detected, opts)
+		span.End(statusError(summary))
+		summary.Log(runCtx)
+
+		if err := summary.WritePlan(os.Stdout, *planFormat); err != nil {
+			fatal("write plan", err)
+		}
+
+		switch {
+		case summary.Status() == cloudflare.PartialFailure:
+			exit(exitPartialFailure)
+		case summary.Status() == cloudflare.TotalFailure:
+			exit(exitTotalFailure)
+		case summary.ChangesPending():
+			exit(exitChangesPending)
+		}
+		return
+	}
+
+	if !*daemon && interval == 0 {
+		runCtx, span := tracing.Start(ctx, "run", tracing.String("mode", "once"))
+		detected, err := ips.detect(runCtx)
+		if err != nil {
+			notifier.Notify(runCtx, notify.FromError(fmt.Errorf("get IPv4: %w", err)))
+			span.End(err)
+			fatal("get IPv4", err)
+		}
+		summary := processZones(runCtx, token, cfg, detected, opts)
+		summary.Log(runCtx)
+		observeRun(summary)
+		notifier.Notify(runCtx, notify.FromSummary(summary, detected))
+		span.End(statusError(summary))
+
+		if gateway := os.Getenv("CF_PUSHGATEWAY_URL"); gateway != "" {
+			if err := metrics.Push(ctx, retry.HTTPClient, gateway, "cloudflare-ddns"); err != nil {
+				slog.Warn("failed to push metrics", "url", gateway, "error", err)
+			}
+		}
+
+		switch summary.Status() {
+		case cloudflare.PartialFailure:
+			slog.Error("cloudflare-ddns completed with failures")
+			exit(exitPartialFailure)
+		case cloudflare.TotalFailure:
+			slog.Error("cloudflare-ddns failed to update any record")
+			exit(exitTotalFailure)
+		}
+
+		slog.Info("cloudflare-ddns completed successfully")
+		return
+	}
+
+	if interval == 0 {
+		interval = defaultInterval
+	}
+	slog.Info("running in daemon mode", "interval", interval)
+
+	readyIntervals, err := parseReadyIntervals(os.Getenv("CF_READY_INTERVALS"))
+	if err != nil {
+		fatal("parse CF_READY_INTERVALS", err)
+	}
+	tracker := health.NewTracker(interval, readyIntervals)
+
+	addr := os.Getenv("CF_LISTEN_ADDR")
+	if addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metrics.Handler())
+		mux.Handle("GET /healthz", tracker.LiveHandler())
+		mux.Handle("GET /readyz", tracker.ReadyHandler())
+		go serveHTTP(ctx, addr, mux)
+	}
+
+	var last cloudflare.DetectedIPs
+	var tokenChecked time.Time
+	var resolved bool
+	accountID := os.Getenv("CF_ACCOUNT_ID")
+	reconcile := func(ctx context.Context) error {
+		if addr != "" && time.Since(tokenChecked) >= tokenCheckInterval {
+			tracker.SetTokenError(cloudflare.VerifyToken(ctx, token, accountID))
+			tokenChecked = time.Now()
+		}
+
+		if !resolved {
+			zones, err := resolveZones(ctx, token, cfg)
+			if err != nil {
+				err = fmt.Errorf("resolve zones: %w", err)
+				notifier.Notify(ctx, notify.FromError(err))
+				return err
+			}
+			cfg.Zones, resolved = zones, true
+		}
+
+		detected, err := ips.detect(ctx)
+		if err != nil {
+			err = fmt.Errorf("get IPv4: %w", err)
+			notifier.Notify(ctx, notify.FromError(err))
+			return err
+		}
+		tracker.SetIPs(detected)
+
+		if detected.Equal(last) {
+			slog.DebugContext(ctx, "public ip unchanged, skipping update", "ipv4", detected.IPv4, "ipv6", detected.IPv6)
+			// last only holds IPs from a fully successful run, so records are still current.
+			metrics.LastSuccess.Set(float64(time.Now().Unix()))
+			return nil
+		}
+
+		summary := processZones(ctx, token, cfg, detected, opts)
+		summary.Log(ctx)
+		observeRun(summary)
+		tracker.SetSummary(summary)
+		notifier.Notify(ctx, notify.FromSummary(summary, detected))
+		if err := statusError(summary); err != nil {
+			return err
+		}
+
+		last = detected
+		return nil
+	}
+
+	err = scheduler.Run(ctx, interval, func(ctx context.Context) error {
+		ctx, span := tracing.Start(ctx, "run", tracing.String("mode", "daemon"))
+		tracker.RunStarted()
+		err := reconcile(ctx)
+		tracker.RunFinished(err)
+		span.End(err)
+		return err
+	})
+	if err != nil {
+		fatal("run scheduler", err)
+	}
+
+	slog.Info("cloudflare-ddns stopped")
+}
+
+type detector struct {
+	ipv4        ip.Provider
+	ipv6        ip.Provider
+	ipv6Enabled bool
+	sources     []ipSource
+}
+
+type ipSource struct {
+	name string
+	ipv4 ip.Provider
+	ipv6 ip.Provider
+}
+
+func newDetector(cfg config.Config, ipv6Enabled bool) (detector, error) {
+	d := detector{ipv6Enabled: ipv6Enabled}
+
+	ipv4Specs := cfg.IPv4Providers
+	if len(ipv4Specs) == 0 {
+		ipv4Specs = []config.IPProvider{{Type: "ipify"}}
+	}
+	ipv6Specs := cfg.IPv6Providers
+	if len(ipv6Specs) == 0 {
+		ipv6Specs = []config.IPProvider{{Type: "ipify"}}
+	}
+
+	var err error
+	if d.ipv4, err = buildProviders(ipv4Specs, cfg.IPv4Quorum); err != nil {
+		return d, err
+	}
+	if d.ipv6, err = buildProviders(ipv6Specs, cfg.IPv6Quorum); err != nil {
+		return d, err
+	}
 
-	ipv4, err := ip.GetWithRetry(ctx, "https://api.ipify.org", false)
+	for _, src := range cfg.IPSources {
+		s := ipSource{name: src.Name}
+		if s.ipv4, err = buildProviders(src.IPv4Providers, 0); err != nil {
+			return d, fmt.Errorf("ip source %s: %w", src.Name, err)
+		}
+		if s.ipv6, err = buildProviders(src.IPv6Providers, 0); err != nil {
+			return d, fmt.Errorf("ip source %s: %w", src.Name, err)
+		}
+		d.sources = append(d.sources, s)
+	}
+
+	return d, nil
+}
+
+func (d detector) detect(ctx context.Context) (cloudflare.DetectedIPs, error) {
+	var detected cloudflare.DetectedIPs
+
+	ipv4, err := d.ipv4.GetIP(ctx, false)
+	observeDetection("ipv4", err)
 	if err != nil {
-		fatal("get IPv4", err)
+		return detected, err
 	}
-	slog.Info("detected public ip", "type", "ipv4", "ip", ipv4)
+	detected.IPv4 = ipv4
+	slog.InfoContext(ctx, "detected public ip", "type", "ipv4", "ip", ipv4)
 
-	var ipv6 string
-	if ipv6Enabled {
-		if ipv6, err = ip.GetWithRetry(ctx, "https://api6.ipify.org", true); err != nil {
-			slog.Warn("ipv6 detection failed after retries", "error", err)
+	if d.ipv6Enabled {
+		ipv6, err := d.ipv6.GetIP(ctx, true)
+		observeDetection("ipv6", err)
+		if err != nil {
+			slog.WarnContext(ctx, "ipv6 detection failed after retries", "error", err)
 		} else {
-			slog.Info("detected public ip", "type", "ipv6", "ip", ipv6)
+			detected.IPv6 = ipv6
+			slog.InfoContext(ctx, "detected public ip", "type", "ipv6", "ip", ipv6)
 		}
 	}
 
+	if len(d.sources) > 0 {
+		detected.Sources = make(map[string]cloudflare.Addresses, len(d.sources))
+	}
+	for _, src := range d.sources {
+		var addrs cloudflare.Addresses
+		if src.ipv4 != nil {
+			addrs.IPv4, err = src.ipv4.GetIP(ctx, false)
+			observeDetection("ipv4", err)
+			if err != nil {
+				slog.WarnContext(ctx, "ip source detection failed", "source", src.name, "type", "ipv4", "error", err)
+			}
+		}
+		if src.ipv6 != nil {
+			addrs.IPv6, err = src.ipv6.GetIP(ctx, true)
+			observeDetection("ipv6", err)
+			if err != nil {
+				slog.WarnContext(ctx, "ip source detection failed", "source", src.name, "type", "ipv6", "error", err)
+			}
+		}
+		detected.Sources[src.name] = addrs
+		slog.InfoContext(ctx, "detected ip source", "source", src.name, "ipv4", addrs.IPv4, "ipv6", addrs.IPv6)
+	}
+
+	observeIPs(detected)
+	return detected, nil
+}
+
+func observeDetection(family string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	metrics.Detections.Inc(family, result)
+}
+
+func observeIPs(detected cloudflare.DetectedIPs) {
+	metrics.DetectedIP.Reset()
+	set := func(source string, addrs cloudflare.Addresses) {
+		if addrs.IPv4 != "" {
+			metrics.DetectedIP.Set(1, source, "ipv4", addrs.IPv4)
+		}
+		if addrs.IPv6 != "" {
+			metrics.DetectedIP.Set(1, source, "ipv6", addrs.IPv6)
+		}
+	}
+	set("default", cloudflare.Addresses{IPv4: detected.IPv4, IPv6: detected.IPv6})
+	for name, addrs := range detected.Sources {
+		set(name, addrs)
+	}
+}
+
+func observeRun(summary cloudflare.RunSummary) {
+	for _, z := range summary.Zones {
+		for _, r := range z.Records {
+			metrics.Records.Inc(string(r.Outcome), r.Type)
+		}
+	}
+	if summary.Status() == cloudflare.Success {
+		metrics.LastSuccess.Set(float64(time.Now().Unix()))
+	}
+}
+
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) {
+	srv := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("serving http", "addr", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("http server failed", "addr", addr, "error", err)
+	}
+}
+
+func buildProviders(specs []config.IPProvider, quorum int) (ip.Provider, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	providers := make([]ip.Provider, 0, len(specs))
+	for _, spec := range specs {
+		p, err := ip.NewProvider(spec)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+
+	if quorum > 0 {
+		return ip.NewQuorum(quorum, providers...), nil
+	}
+	return ip.NewChain(providers...), nil
+}
+
+// resolveZones returns cfg.Zones with zone names looked up and records
+// assigned to their zones. cfg is left untouched so a failed attempt can be
+// retried.
+func resolveZones(ctx context.Context, token string, cfg config.Config) ([]config.Zone, error) {
+	zones := slices.Clone(cfg.Zones)
+	for i := range zones {
+		z := &zones[i]
+		if z.ZoneID != "" {
+			continue
+		}
+
+		id, err := cloudflare.LookupZoneID(ctx, token, z.Name)
+		if err != nil {
+			return nil, fmt.Errorf("zone %s: %w", z.Name, err)
+		}
+		z.ZoneID = id
+		slog.Info("resolved zone", "zone", z.Name, "zone_id", id)
+	}
+
+	if len(cfg.Records) == 0 {
+		return zones, nil
+	}
+
+	visible, err := cloudflare.ListZones(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	assigned, err := cloudflare.AssignZones(cfg.Records, visible)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range assigned {
+		slog.Info("assigned records to zone", "zone", a.Name, "zone_id", a.ZoneID, "records", len(a.Subdomains))
+		merged := false
+		for i := range zones {
+			if zones[i].ZoneID == a.ZoneID {
+				zones[i].Subdomains = slices.Concat(zones[i].Subdomains, a.Subdomains)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			zones = append(zones, a)
+		}
+	}
+	return zones, nil
+}
+
+func processZones(ctx context.Context, token string, cfg config.Config, ips cloudflare.DetectedIPs, opts cloudflare.Options) cloudflare.RunSummary {
+	summary := cloudflare.RunSummary{Zones: make([]cloudflare.ZoneSummary, len(cfg.Zones)), DryRun: opts.DryRun}
 	var wg sync.WaitGroup
-	for _, zone := range cfg.Zones {
+
+	for i, zone := range cfg.Zones {
 		wg.Add(1)
-		go func(z config.Zone) {
+		go func(i int, z config.Zone) {
 			defer wg.Done()
-			if err := cloudflare.ProcessZone(ctx, token, z, ipv4, ipv6, cfg.DefaultTTL, cfg.ConcurrencyLimit); err != nil {
-				slog.Error("failed to process zone", "zone_id", z.ZoneID, "error", err)
+			zs, err := cloudflare.ProcessZone(ctx, token, z, ips, opts)
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to process zone", "zone_id", z.ZoneID, "error", err, cloudflare.ErrorDetails(err))
+				zs.Err = err
 			}
-		}(zone)
+			summary.Zones[i] = zs
+		}(i, zone)
 	}
 	wg.Wait()
 
-	slog.Info("cloudflare-ddns completed successfully")
+	return summary
+}
+
+func loadConfig(path string) (config.Config, error) {
+	if path == "" {
+		path = os.Getenv("CF_CONFIG_FILE")
+	}
+
+	if path != "" {
+		if os.Getenv("CF_CONFIG") != "" {
+			slog.Warn("both a config file and CF_CONFIG are set, ignoring CF_CONFIG", "path", path)
+		}
+		slog.Info("loading config file", "path", path)
+		return config.Load(path)
+	}
+
+	configJSON := os.Getenv("CF_CONFIG")
+	if configJSON == "" {
+		return config.Config{}, fmt.Errorf("no config provided: set --config, CF_CONFIG_FILE or CF_CONFIG")
+	}
+	return config.Parse([]byte(configJSON), "json")
+}
+
+func parseInterval(val string) (time.Duration, error) {
+	if val == "" {
+		return 0, nil
+	}
+
+	interval, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, err
+	}
+	if interval < 10*time.Second {
+		return 0, fmt.Errorf("interval must be at least 10s, got %s", interval)
+	}
+
+	return interval, nil
+}
+
+func parseReadyIntervals(val string) (int, error) {
+	if val == "" {
+		return 3, nil
+	}
+
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 {
+		return 0, fmt.Errorf("must be at least 1, got %d", n)
+	}
+
+	return n, nil
 }
 
 func mustEnv(key string) string {
 	val := os.Getenv(key)
 	if val == "" {
 		slog.Error("missing required env var", "key", key)
-		os.Exit(1)
+		exit(exitFatal)
 	}
 	return val
 }
 
 func fatal(msg string, err error) {
 	slog.Error("fatal error", "context", msg, "error", err)
-	os.Exit(1)
+	exit(exitFatal)
+}
+
+func statusError(summary cloudflare.RunSummary) error {
+	if status := summary.Status(); status != cloudflare.Success {
+		return fmt.Errorf("run finished with status %s", status)
+	}
+	return nil
+}
+
+// exit flushes pending traces, which os.Exit would otherwise drop.
+func exit(code int) {
+	flushTraces()
+	os.Exit(code)
+}
+
+func flushTraces() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tracing.Shutdown(ctx)
 }